@@ -23,60 +23,147 @@ package build
 
 import (
     "fmt"
+    "io"
+    "os"
+    "runtime"
+    "sort"
+    "text/tabwriter"
     "time"
 
     "github.com/briandowns/spinner"
     "github.com/spf13/cobra"
     "github.com/spf13/viper"
+    "golang.org/x/term"
     "go-cli/internal/build"
+    "go-cli/internal/config"
+    "go-cli/internal/env"
 )
 
 // buildCmd represents the build command
 var buildCmd = &cobra.Command{
-    Use:   "build [app-name]",
-    Short: "Build an application",
-    Long:  `Build a specific application.`,
-    Args:  cobra.ExactArgs(1),
-    Run: func(cmd *cobra.Command, args []string) {
-        appName := args[0]
+    Use:   "build [app-name...]",
+    Short: "Build applications",
+    Long: `Build one or more applications, or every configured application with --all.
+Several applications are built in parallel, at most --jobs at a time.`,
+    Args: func(cmd *cobra.Command, args []string) error {
+        if all, _ := cmd.Flags().GetBool("all"); all == (len(args) > 0) {
+            return fmt.Errorf("specify application names or --all")
+        }
+        return nil
+    },
+    RunE: func(cmd *cobra.Command, args []string) error {
         verbose, _ := cmd.Flags().GetBool("verbose")
-        
-        // Read configuration for the application
-        var config build.BuildConfig
-        configKey := fmt.Sprintf("apps.%s", appName)
-        if err := viper.UnmarshalKey(configKey, &config); err != nil {
-            fmt.Printf("Error reading configuration for app '%s': %v\n", appName, err)
-            return
+        dryRun, _ := cmd.Flags().GetBool("dry-run")
+        all, _ := cmd.Flags().GetBool("all")
+        jobs, _ := cmd.Flags().GetInt("jobs")
+
+        // Read configuration for the applications
+        var configs map[string]build.BuildConfig
+        if err := viper.UnmarshalKey("apps", &configs); err != nil {
+            return config.Invalid("apps", err)
+        }
+
+        names := args
+        if all {
+            names = nil
+            for name := range configs {
+                names = append(names, name)
+            }
+            sort.Strings(names)
+            if len(names) == 0 {
+                return config.Required("apps")
+            }
         }
-        
-        // Check if configuration exists
-        if config.ProjectPath == "" {
-            fmt.Printf("No configuration found for application '%s'\n", appName)
-            return
+
+        if len(names) == 1 {
+            return buildOne(names[0], configs[names[0]], verbose, dryRun)
         }
-        
-        var s *spinner.Spinner
-        if !verbose {
-            s = spinner.New(spinner.CharSets[14], 100*time.Millisecond)
-            s.Suffix = fmt.Sprintf(" Building application %s...", appName)
-            s.Start()
+
+        var out io.Writer
+        var p *progress
+        switch {
+        case verbose:
+            out = os.Stdout
+        case !dryRun:
+            // Redrawing lines needs a terminal, logs and pipes get plain lines
+            p = newProgress(os.Stdout, names, term.IsTerminal(int(os.Stdout.Fd())))
+            p.Start()
         }
 
-        err := build.Build(config, verbose)
+        var onStart func(string)
+        var onDone func(build.Result)
+        if p != nil {
+            onStart, onDone = p.Started, p.Done
+        }
 
-        if !verbose && s != nil {
-            s.Stop()
+        results, err := build.BuildAll(configs, names, jobs, out, onStart, onDone)
+
+        if p != nil {
+            p.Stop()
         }
-        
+
+        printSummary(results)
         if err != nil {
-            fmt.Printf("Error building application: %v\n", err)
-        } else {
-            fmt.Printf("Application %s built successfully!\n", appName)
+            return err
         }
+        fmt.Printf("%d applications built successfully!\n", len(results))
+        return nil
     },
 }
 
+func buildOne(appName string, appConfig build.BuildConfig, verbose bool, dryRun bool) error {
+    // Check if configuration exists
+    if appConfig.ProjectPath == "" {
+        return &config.NotFoundError{Kind: "application", Name: appName}
+    }
+
+    var s *spinner.Spinner
+    if !verbose && !dryRun {
+        s = spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+        s.Suffix = fmt.Sprintf(" Building application %s...", appName)
+        s.Start()
+    }
+
+    err := build.Build(appConfig, verbose)
+
+    if s != nil {
+        s.Stop()
+    }
+
+    if err != nil {
+        return fmt.Errorf("failed to build application %s: %w", appName, err)
+    }
+    fmt.Printf("Application %s built successfully!\n", appName)
+    return nil
+}
+
+func printSummary(results []build.Result) {
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(w, "APP\tSTATUS\tDURATION\tERROR")
+    var details []build.Result
+    for _, result := range results {
+        status, detail := "ok", ""
+        if result.Err != nil {
+            var more bool
+            status = "failed"
+            detail, more = env.FirstLine(result.Err.Error())
+            if more {
+                details = append(details, result)
+            }
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Name, status, result.Duration.Round(100*time.Millisecond), detail)
+    }
+    w.Flush()
+
+    // Captured tool output is shown below the table
+    for _, result := range details {
+        fmt.Printf("\n%s: %v\n", result.Name, result.Err)
+    }
+}
+
 func GetCommand() *cobra.Command {
     buildCmd.Flags().Bool("verbose", false, "Show Docker build output")
+    buildCmd.Flags().Bool("all", false, "Build every configured application")
+    buildCmd.Flags().IntP("jobs", "j", runtime.NumCPU(), "Maximum number of builds running in parallel")
     return buildCmd
 }
@@ -0,0 +1,143 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package build
+
+import (
+    "fmt"
+    "io"
+    "sync"
+    "time"
+
+    "github.com/briandowns/spinner"
+    "go-cli/internal/build"
+)
+
+// progress redraws one spinner line per application while they build. When
+// the output is not a terminal it prints one plain line per change instead.
+type progress struct {
+    mu      sync.Mutex
+    out     io.Writer
+    live    bool
+    names   []string
+    width   int
+    started map[string]time.Time
+    results map[string]build.Result
+    frame   int
+    drawn   bool
+    stop    chan struct{}
+    stopped chan struct{}
+}
+
+func newProgress(out io.Writer, names []string, live bool) *progress {
+    width := 0
+    for _, name := range names {
+        width = max(width, len(name))
+    }
+    return &progress{
+        out:     out,
+        live:    live,
+        names:   names,
+        width:   width,
+        started: make(map[string]time.Time),
+        results: make(map[string]build.Result),
+        stop:    make(chan struct{}),
+        stopped: make(chan struct{}),
+    }
+}
+
+func (p *progress) Start() {
+    if !p.live {
+        close(p.stopped)
+        return
+    }
+    go func() {
+        defer close(p.stopped)
+        ticker := time.NewTicker(100 * time.Millisecond)
+        defer ticker.Stop()
+        for {
+            p.render()
+            select {
+            case <-p.stop:
+                p.render()
+                return
+            case <-ticker.C:
+            }
+        }
+    }()
+}
+
+func (p *progress) Stop() {
+    close(p.stop)
+    <-p.stopped
+}
+
+func (p *progress) Started(name string) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.started[name] = time.Now()
+    if !p.live {
+        fmt.Fprintf(p.out, "building %s\n", name)
+    }
+}
+
+func (p *progress) Done(result build.Result) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.results[result.Name] = result
+    if !p.live {
+        if result.Err != nil {
+            fmt.Fprintf(p.out, "%s failed after %s\n", result.Name, result.Duration.Round(100*time.Millisecond))
+        } else {
+            fmt.Fprintf(p.out, "%s built in %s\n", result.Name, result.Duration.Round(100*time.Millisecond))
+        }
+    }
+}
+
+func (p *progress) render() {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    frames := spinner.CharSets[14]
+    p.frame = (p.frame + 1) % len(frames)
+
+    // Move back to the first line drawn last time
+    if p.drawn {
+        fmt.Fprintf(p.out, "\033[%dA", len(p.names))
+    }
+    p.drawn = true
+
+    for _, name := range p.names {
+        var line string
+        if result, done := p.results[name]; done {
+            if result.Err != nil {
+                line = fmt.Sprintf("✗ %-*s  failed after %s", p.width, name, result.Duration.Round(100*time.Millisecond))
+            } else {
+                line = fmt.Sprintf("✓ %-*s  built in %s", p.width, name, result.Duration.Round(100*time.Millisecond))
+            }
+        } else if start, building := p.started[name]; building {
+            line = fmt.Sprintf("%s %-*s  building %s", frames[p.frame], p.width, name, time.Since(start).Round(time.Second))
+        } else {
+            line = fmt.Sprintf("  %-*s  queued", p.width, name)
+        }
+        fmt.Fprintf(p.out, "\r\033[2K%s\n", line)
+    }
+}
@@ -0,0 +1,73 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package build
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+
+    "go-cli/internal/build"
+    "go-cli/internal/runner"
+)
+
+func TestProgressWithoutTerminal(t *testing.T) {
+    build.SetRunner(&runner.Recorder{})
+    t.Cleanup(func() { build.SetRunner(runner.Exec{}) })
+
+    configs := map[string]build.BuildConfig{
+        "api": {
+            ProjectPath: t.TempDir(),
+            Build:       build.BuildDetails{ImageName: "api:local", Dockerfile: "Dockerfile", Context: "."},
+        },
+    }
+    names := []string{"api", "web"}
+
+    var out bytes.Buffer
+    p := newProgress(&out, names, false)
+    p.Start()
+    _, err := build.BuildAll(configs, names, 1, nil, p.Started, p.Done)
+    p.Stop()
+
+    if err == nil {
+        t.Fatal("BuildAll() error = nil, want the missing web application")
+    }
+    // Builds start in any order, each app reports its start then its result
+    lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+    index := make(map[string]int)
+    for i, line := range lines {
+        index[line] = i
+    }
+    if len(lines) != 4 {
+        t.Fatalf("output = %q, want 4 lines", out.String())
+    }
+    for _, pair := range [][2]string{{"building api", "api built in 0s"}, {"building web", "web failed after 0s"}} {
+        start, okStart := index[pair[0]]
+        done, okDone := index[pair[1]]
+        if !okStart || !okDone || start > done {
+            t.Errorf("output = %q, want %q followed by %q", out.String(), pair[0], pair[1])
+        }
+    }
+    if strings.Contains(out.String(), "\033") {
+        t.Error("output contains terminal escape sequences")
+    }
+}
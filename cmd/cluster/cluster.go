@@ -23,20 +23,23 @@ package cluster
 
 import (
     "fmt"
+    "os"
+    "text/tabwriter"
     "time"
 
     "github.com/briandowns/spinner"
     "github.com/spf13/cobra"
     "go-cli/internal/cluster"
+    "go-cli/internal/doctor"
 )
 
 // clusterCmd represents the cluster command
 var clusterCmd = &cobra.Command{
     Use:   "cluster",
     Short: "Manage cluster operations",
-    Long:  `Manage cluster operations including create, delete, start, and stop.`,
-    Run: func(cmd *cobra.Command, args []string) {
-        cmd.Help()
+    Long:  `Manage cluster operations including create, delete, start, stop, status, list and use.`,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        return cmd.Help()
     },
 }
 
@@ -44,28 +47,44 @@ var clusterCmd = &cobra.Command{
 var createCmd = &cobra.Command{
     Use:   "create",
     Short: "Create a new cluster",
-    Long:  `Create a new cluster with the specified configuration.`,
-    Run: func(cmd *cobra.Command, args []string) {
+    Long: `Create a new k3d cluster shaped by the cluster section of the configuration,
+or by the clusters section for the cluster selected with --name. The new
+cluster becomes the active one.`,
+    RunE: func(cmd *cobra.Command, args []string) error {
         verbose, _ := cmd.Flags().GetBool("verbose")
+        dryRun, _ := cmd.Flags().GetBool("dry-run")
+        skipPreflight, _ := cmd.Flags().GetBool("skip-preflight")
+
+        name, _ := cmd.Flags().GetString("name")
+        clusterConfig, err := cluster.ReadConfig(name)
+        if err != nil {
+            return err
+        }
+
+        if !skipPreflight && !dryRun {
+            if err := doctor.Preflight(doctor.ForCluster(clusterConfig)); err != nil {
+                return err
+            }
+        }
         
         var s *spinner.Spinner
-        if !verbose {
+        if !verbose && !dryRun {
             s = spinner.New(spinner.CharSets[14], 100*time.Millisecond)
             s.Suffix = " Creating cluster..."
             s.Start()
         }
 
-        err := cluster.Create(verbose)
+        err = cluster.Create(clusterConfig, verbose)
 
-        if !verbose && s != nil {
+        if s != nil {
             s.Stop()
         }
         
         if err != nil {
-            fmt.Printf("Error creating cluster: %v\n", err)
-        } else {
-            fmt.Println("Cluster created successfully!")
+            return fmt.Errorf("failed to create cluster: %w", err)
         }
+        fmt.Printf("Cluster %s created successfully!\n", clusterConfig.Name)
+        return nil
     },
 }
 
@@ -73,22 +92,32 @@ var createCmd = &cobra.Command{
 var deleteCmd = &cobra.Command{
     Use:   "delete",
     Short: "Delete a cluster",
-    Long:  `Delete an existing cluster.`,
-    Run: func(cmd *cobra.Command, args []string) {
+    Long: `Delete the active cluster, or the one selected with --name. The local registry
+is stopped once no cluster remains.`,
+    RunE: func(cmd *cobra.Command, args []string) error {
         verbose, _ := cmd.Flags().GetBool("verbose")
+        dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+        name, _ := cmd.Flags().GetString("name")
+        clusterConfig, err := cluster.ReadConfig(name)
+        if err != nil {
+            return err
+        }
         
-        // Ask for confirmation
-        fmt.Print("Are you sure you want to delete the cluster? (y/N): ")
-        var response string
-        fmt.Scanln(&response)
-        
-        if response != "y" && response != "Y" {
-            fmt.Println("Cluster deletion cancelled.")
-            return
+        // Ask for confirmation, nothing is deleted in dry-run mode
+        if !dryRun {
+            fmt.Printf("Are you sure you want to delete the cluster %s? (y/N): ", clusterConfig.Name)
+            var response string
+            fmt.Scanln(&response)
+            
+            if response != "y" && response != "Y" {
+                fmt.Println("Cluster deletion cancelled.")
+                return nil
+            }
         }
         
         var s *spinner.Spinner
-        if !verbose {
+        if !verbose && !dryRun {
             s = spinner.New(spinner.CharSets[14], 100*time.Millisecond)
             s.Suffix = " Deleting cluster..."
             s.Start()
@@ -96,30 +125,247 @@ var deleteCmd = &cobra.Command{
 
         removeRegistry, _ := cmd.Flags().GetBool("remove-registry")
         
-        err := cluster.Delete(verbose, removeRegistry)
+        registryStopped, err := cluster.Delete(clusterConfig, verbose, removeRegistry)
 
-        if !verbose && s != nil {
+        if s != nil {
             s.Stop()
         }
         
         if err != nil {
-            fmt.Printf("Error deleting cluster: %v\n", err)
-        } else {
-            if removeRegistry {
-                fmt.Println("Cluster and registry deleted successfully!")
-            } else {
-                fmt.Println("Cluster deleted successfully! (Registry stopped but not removed)")
+            return fmt.Errorf("failed to delete cluster: %w", err)
+        }
+        switch {
+        case !registryStopped:
+            fmt.Printf("Cluster %s deleted successfully! (Registry kept for the remaining clusters)\n", clusterConfig.Name)
+        case removeRegistry:
+            fmt.Printf("Cluster %s and registry deleted successfully!\n", clusterConfig.Name)
+        default:
+            fmt.Printf("Cluster %s deleted successfully! (Registry stopped but not removed)\n", clusterConfig.Name)
+        }
+        return nil
+    },
+}
+
+// listCmd represents the list subcommand
+var listCmd = &cobra.Command{
+    Use:   "list",
+    Short: "List clusters",
+    Long:  `List the k3d clusters present on this host, marking the active one.`,
+    Args:  cobra.NoArgs,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        clusters, err := cluster.List()
+        if err != nil {
+            return err
+        }
+
+        active := cluster.ActiveName()
+        w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(w, "ACTIVE\tNAME\tSERVERS\tAGENTS")
+        for _, c := range clusters {
+            marker := ""
+            if c.Name == active {
+                marker = "*"
             }
+            fmt.Fprintf(w, "%s\t%s\t%d/%d\t%d/%d\n", marker, c.Name, c.ServersRunning, c.Servers, c.AgentsRunning, c.Agents)
         }
+        w.Flush()
+        return nil
     },
 }
 
+// useCmd represents the use subcommand
+var useCmd = &cobra.Command{
+    Use:   "use <name>",
+    Short: "Switch to a cluster",
+    Long: `Switch the kubeconfig context to a cluster and make it the active cluster,
+targeted by the build, install, uninstall, up and down commands.`,
+    Args: cobra.ExactArgs(1),
+    RunE: func(cmd *cobra.Command, args []string) error {
+        verbose, _ := cmd.Flags().GetBool("verbose")
+
+        if err := cluster.Use(args[0], verbose); err != nil {
+            return fmt.Errorf("failed to switch to cluster %s: %w", args[0], err)
+        }
+        fmt.Printf("Switched to cluster %s (context %s)\n", args[0], cluster.KubeContext(args[0]))
+        return nil
+    },
+}
+
+// startCmd represents the start subcommand
+var startCmd = &cobra.Command{
+    Use:   "start",
+    Short: "Start a cluster",
+    Long:  `Start the local registry and the active cluster, or the one selected with --name.`,
+    Args:  cobra.NoArgs,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        verbose, _ := cmd.Flags().GetBool("verbose")
+        dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+        name, _ := cmd.Flags().GetString("name")
+        clusterConfig, err := cluster.ReadConfig(name)
+        if err != nil {
+            return err
+        }
+
+        var s *spinner.Spinner
+        if !verbose && !dryRun {
+            s = spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+            s.Suffix = " Starting cluster..."
+            s.Start()
+        }
+
+        err = cluster.Start(clusterConfig, verbose)
+
+        if s != nil {
+            s.Stop()
+        }
+
+        if err != nil {
+            return fmt.Errorf("failed to start cluster: %w", err)
+        }
+        fmt.Printf("Cluster %s started successfully!\n", clusterConfig.Name)
+        return nil
+    },
+}
+
+// stopCmd represents the stop subcommand
+var stopCmd = &cobra.Command{
+    Use:   "stop",
+    Short: "Stop a cluster",
+    Long: `Stop the active cluster, or the one selected with --name. The local registry
+is stopped too once no other cluster is running.`,
+    Args: cobra.NoArgs,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        verbose, _ := cmd.Flags().GetBool("verbose")
+        dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+        name, _ := cmd.Flags().GetString("name")
+        clusterConfig, err := cluster.ReadConfig(name)
+        if err != nil {
+            return err
+        }
+
+        var s *spinner.Spinner
+        if !verbose && !dryRun {
+            s = spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+            s.Suffix = " Stopping cluster..."
+            s.Start()
+        }
+
+        registryStopped, err := cluster.Stop(clusterConfig, verbose)
+
+        if s != nil {
+            s.Stop()
+        }
+
+        if err != nil {
+            return fmt.Errorf("failed to stop cluster: %w", err)
+        }
+        if registryStopped {
+            fmt.Printf("Cluster %s and registry stopped successfully!\n", clusterConfig.Name)
+        } else {
+            fmt.Printf("Cluster %s stopped successfully! (Registry kept for the running clusters)\n", clusterConfig.Name)
+        }
+        return nil
+    },
+}
+
+// statusCmd represents the status subcommand
+var statusCmd = &cobra.Command{
+    Use:   "status",
+    Short: "Show the status of a cluster",
+    Long: `Show the readiness of the nodes of the active cluster, or of the one selected
+with --name, the health of the local registry and the kubeconfig context in use.`,
+    Args: cobra.NoArgs,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        name, _ := cmd.Flags().GetString("name")
+        clusterConfig, err := cluster.ReadConfig(name)
+        if err != nil {
+            return err
+        }
+
+        status, err := cluster.GetStatus(clusterConfig)
+        if err != nil {
+            return err
+        }
+        printStatus(status)
+
+        if !status.Exists {
+            return fmt.Errorf("cluster %s does not exist", status.Name)
+        }
+        return nil
+    },
+}
+
+func printStatus(status cluster.Status) {
+    active := ""
+    if status.Name == cluster.ActiveName() {
+        active = " (active)"
+    }
+    fmt.Printf("Cluster:  %s%s\n", status.Name, active)
+
+    if status.Exists {
+        fmt.Println("Nodes:")
+        w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(w, "  NAME\tROLE\tRUNNING\tREADY")
+        for _, node := range status.Nodes {
+            ready := "unknown"
+            if node.Ready != nil {
+                ready = yesNo(*node.Ready)
+            }
+            fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", node.Name, node.Role, yesNo(node.Running), ready)
+        }
+        w.Flush()
+    }
+
+    switch {
+    case status.RegistryState == "":
+        fmt.Printf("Registry: %s does not exist\n", status.Registry.Name)
+    case status.RegistryState != "running":
+        fmt.Printf("Registry: %s is %s\n", status.Registry.Name, status.RegistryState)
+    case status.RegistryHealthy:
+        fmt.Printf("Registry: %s is running and healthy at %s\n", status.Registry.Name, status.Registry.Address())
+    default:
+        fmt.Printf("Registry: %s is running but %s does not answer\n", status.Registry.Name, status.Registry.Address())
+    }
+
+    expected := cluster.KubeContext(status.Name)
+    switch status.Context {
+    case "":
+        fmt.Println("Context:  none set")
+    case expected:
+        fmt.Printf("Context:  %s\n", status.Context)
+    default:
+        fmt.Printf("Context:  %s (not %s, run 'go-cli cluster use %s' to switch)\n", status.Context, expected, status.Name)
+    }
+}
+
+func yesNo(b bool) string {
+    if b {
+        return "yes"
+    }
+    return "no"
+}
 
 func GetCommand() *cobra.Command {
     createCmd.Flags().Bool("verbose", false, "Show k3d output")
+    createCmd.Flags().Bool("skip-preflight", false, "Do not check the toolchain before creating the cluster")
+    createCmd.Flags().String("name", "", "Name of the cluster (default is the active cluster)")
     deleteCmd.Flags().Bool("verbose", false, "Show k3d output")
     deleteCmd.Flags().Bool("remove-registry", false, "Remove Docker registry container")
+    deleteCmd.Flags().String("name", "", "Name of the cluster (default is the active cluster)")
+    useCmd.Flags().Bool("verbose", false, "Show k3d output")
+    startCmd.Flags().Bool("verbose", false, "Show k3d and Docker output")
+    startCmd.Flags().String("name", "", "Name of the cluster (default is the active cluster)")
+    stopCmd.Flags().Bool("verbose", false, "Show k3d and Docker output")
+    stopCmd.Flags().String("name", "", "Name of the cluster (default is the active cluster)")
+    statusCmd.Flags().String("name", "", "Name of the cluster (default is the active cluster)")
     clusterCmd.AddCommand(createCmd)
     clusterCmd.AddCommand(deleteCmd)
+    clusterCmd.AddCommand(listCmd)
+    clusterCmd.AddCommand(useCmd)
+    clusterCmd.AddCommand(startCmd)
+    clusterCmd.AddCommand(stopCmd)
+    clusterCmd.AddCommand(statusCmd)
     return clusterCmd
 }
@@ -0,0 +1,74 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package config
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/spf13/cobra"
+    cfg "go-cli/internal/config"
+    "go-cli/internal/env"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+    Use:   "config",
+    Short: "Inspect the configuration",
+    Long:  `Inspect the configuration merged from the user and project configuration files.`,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        return cmd.Help()
+    },
+}
+
+// validateCmd represents the validate subcommand
+var validateCmd = &cobra.Command{
+    Use:   "validate",
+    Short: "Validate the configuration",
+    Long: `Reject unknown keys, check the required fields of apps and dependencies and
+that the files and directories they point at exist. Problems are reported with
+the file, line and column declaring them.
+
+The same validation runs before every other command.`,
+    Args: cobra.NoArgs,
+    // Problems loading the configuration are reported like the others
+    Annotations: map[string]string{"config": "optional"},
+    RunE: func(cmd *cobra.Command, args []string) error {
+        if err := cfg.Reload(); err != nil {
+            return err
+        }
+        files := cfg.Files()
+        if len(files) == 0 {
+            return fmt.Errorf("no configuration file found, create $HOME/.config/cli/config.yaml or %s, or pass --config", cfg.ProjectFile)
+        }
+        if err := env.Validate(); err != nil {
+            return err
+        }
+        fmt.Printf("Configuration is valid (%s)\n", strings.Join(files, ", "))
+        return nil
+    },
+}
+
+func GetCommand() *cobra.Command {
+    configCmd.AddCommand(validateCmd)
+    return configCmd
+}
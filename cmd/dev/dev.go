@@ -0,0 +1,112 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package dev
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "os/signal"
+    "strings"
+    "time"
+
+    "github.com/spf13/cobra"
+    "github.com/spf13/viper"
+    "go-cli/internal/config"
+    "go-cli/internal/deploy"
+    "go-cli/internal/dev"
+)
+
+// devCmd represents the dev command
+var devCmd = &cobra.Command{
+    Use:   "dev [app-name]",
+    Short: "Rebuild and redeploy an application on changes",
+    Long: `Watch the project path of an application and, whenever its sources change,
+rebuild its image, publish it and upgrade its Helm release. Use the
+apps.<name>.dev section to set include/exclude globs and the debounce delay.`,
+    Args: cobra.ExactArgs(1),
+    RunE: func(cmd *cobra.Command, args []string) error {
+        appName := args[0]
+        verbose, _ := cmd.Flags().GetBool("verbose")
+
+        // Read configuration for the application
+        var appConfig deploy.AppConfig
+        var devConfig dev.Config
+        configKey := fmt.Sprintf("apps.%s", appName)
+        if err := viper.UnmarshalKey(configKey, &appConfig); err != nil {
+            return config.Invalid(configKey, err)
+        }
+        if err := viper.UnmarshalKey(configKey+".dev", &devConfig); err != nil {
+            return config.Invalid(configKey+".dev", err)
+        }
+
+        // Check if configuration exists
+        if appConfig.ProjectPath == "" {
+            return &config.NotFoundError{Kind: "application", Name: appName}
+        }
+
+        ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+        defer stop()
+
+        fmt.Printf("Watching %s for application %s (Ctrl+C to stop)\n", appConfig.ProjectPath, appName)
+        err := dev.Watch(ctx, appName, appConfig, devConfig, verbose, func(cycle dev.Cycle) {
+            fmt.Println(statusLine(appName, cycle))
+        })
+        if err != nil {
+            return fmt.Errorf("failed to watch application %s: %w", appName, err)
+        }
+        return nil
+    },
+}
+
+// statusLine summarizes a rebuild cycle on a single line
+func statusLine(appName string, cycle dev.Cycle) string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "[%s] %s", time.Now().Format("15:04:05"), appName)
+
+    switch n := len(cycle.Changed); {
+    case n == 0:
+        b.WriteString(" (initial)")
+    case n == 1:
+        fmt.Fprintf(&b, " (%s changed)", cycle.Changed[0])
+    default:
+        fmt.Fprintf(&b, " (%d files changed)", n)
+    }
+
+    if cycle.BuildErr != nil {
+        fmt.Fprintf(&b, ": build failed after %s: %v", cycle.BuildDuration.Round(100*time.Millisecond), cycle.BuildErr)
+        return b.String()
+    }
+    fmt.Fprintf(&b, ": build ok %s", cycle.BuildDuration.Round(100*time.Millisecond))
+
+    if cycle.InstallErr != nil {
+        fmt.Fprintf(&b, ", install failed after %s: %v", cycle.InstallDuration.Round(100*time.Millisecond), cycle.InstallErr)
+        return b.String()
+    }
+    fmt.Fprintf(&b, ", install ok %s", cycle.InstallDuration.Round(100*time.Millisecond))
+    return b.String()
+}
+
+func GetCommand() *cobra.Command {
+    devCmd.Flags().Bool("verbose", false, "Show Docker and Helm output")
+    return devCmd
+}
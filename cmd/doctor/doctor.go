@@ -0,0 +1,59 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package doctor
+
+import (
+    "os"
+
+    "github.com/spf13/cobra"
+    "go-cli/internal/cluster"
+    "go-cli/internal/doctor"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+    Use:   "doctor",
+    Short: "Check the local toolchain",
+    Long: `Check that docker, k3d, helm and kubectl are installed in supported versions,
+that the Docker daemon is reachable, the state of the local registry, that the
+registry and k3d load balancer ports are free, and that the configuration file
+is valid. Problems are reported with a hint on how to fix them.
+
+The same checks run before 'cluster create' and 'up'.`,
+    Args: cobra.NoArgs,
+    // An unreadable configuration file is reported as a failed check
+    Annotations: map[string]string{"config": "optional"},
+    RunE: func(cmd *cobra.Command, args []string) error {
+        // Check the default cluster shape when the configuration is invalid, the config check reports it
+        clusterConfig, err := cluster.ReadConfig("")
+        if err != nil {
+            clusterConfig = cluster.DefaultConfig()
+        }
+        results := doctor.Run(doctor.All(clusterConfig))
+        doctor.Print(os.Stdout, results)
+        return doctor.Failed(results)
+    },
+}
+
+func GetCommand() *cobra.Command {
+    return doctorCmd
+}
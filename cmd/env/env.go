@@ -0,0 +1,135 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package env
+
+import (
+    "fmt"
+    "os"
+    "time"
+
+    "github.com/briandowns/spinner"
+    "github.com/spf13/cobra"
+    "go-cli/internal/doctor"
+    "go-cli/internal/env"
+)
+
+// upCmd represents the up command
+var upCmd = &cobra.Command{
+    Use:   "up",
+    Short: "Bring the whole environment up",
+    Long: `Create the cluster if missing, configure Helm repositories and build every
+application, then install dependencies and applications following their
+depends_on declarations. Independent installs run in parallel.`,
+    Args: cobra.NoArgs,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        verbose, _ := cmd.Flags().GetBool("verbose")
+        dryRun, _ := cmd.Flags().GetBool("dry-run")
+        skipPreflight, _ := cmd.Flags().GetBool("skip-preflight")
+
+        config, err := env.ReadConfig()
+        if err != nil {
+            return err
+        }
+
+        if !skipPreflight && !dryRun {
+            if err := doctor.Preflight(doctor.ForUp(config.Cluster)); err != nil {
+                return err
+            }
+        }
+
+        s, onStep := progress(verbose || dryRun)
+        steps, err := env.Up(config, verbose, onStep)
+        if s != nil {
+            s.Stop()
+        }
+
+        env.PrintSummary(os.Stdout, steps)
+        if err != nil {
+            return fmt.Errorf("failed to bring environment up: %w", err)
+        }
+        fmt.Println("Environment is up!")
+        return nil
+    },
+}
+
+// downCmd represents the down command
+var downCmd = &cobra.Command{
+    Use:   "down",
+    Short: "Tear the whole environment down",
+    Long: `Uninstall every application and dependency from the configuration in reverse
+dependency order, then delete the cluster.`,
+    Args: cobra.NoArgs,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        verbose, _ := cmd.Flags().GetBool("verbose")
+        dryRun, _ := cmd.Flags().GetBool("dry-run")
+        removeRegistry, _ := cmd.Flags().GetBool("remove-registry")
+
+        config, err := env.ReadConfig()
+        if err != nil {
+            return err
+        }
+
+        s, onStep := progress(verbose || dryRun)
+        steps, err := env.Down(config, verbose, removeRegistry, onStep)
+        if s != nil {
+            s.Stop()
+        }
+
+        env.PrintSummary(os.Stdout, steps)
+        if err != nil {
+            return fmt.Errorf("failed to tear environment down: %w", err)
+        }
+        fmt.Println("Environment is down!")
+        return nil
+    },
+}
+
+// progress returns a spinner following the current steps, or prints the
+// step names when the tools' own output is shown. Steps installed in
+// parallel report concurrently.
+func progress(quiet bool) (*spinner.Spinner, func(name string)) {
+    if quiet {
+        return nil, func(name string) {
+            fmt.Printf("==> %s\n", name)
+        }
+    }
+
+    s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
+    s.Start()
+    return s, func(name string) {
+        s.Lock()
+        s.Suffix = fmt.Sprintf(" %s...", name)
+        s.Unlock()
+    }
+}
+
+func GetUpCommand() *cobra.Command {
+    upCmd.Flags().Bool("verbose", false, "Show k3d, Docker and Helm output")
+    upCmd.Flags().Bool("skip-preflight", false, "Do not check the toolchain before bringing the environment up")
+    return upCmd
+}
+
+func GetDownCommand() *cobra.Command {
+    downCmd.Flags().Bool("verbose", false, "Show k3d and Helm output")
+    downCmd.Flags().Bool("remove-registry", false, "Remove Docker registry container")
+    return downCmd
+}
@@ -23,12 +23,15 @@ package install
 
 import (
     "fmt"
+    "os"
     "time"
 
     "github.com/spf13/cobra"
     "github.com/spf13/viper"
     "github.com/briandowns/spinner"
+    "go-cli/internal/config"
     "go-cli/internal/deploy"
+    "go-cli/internal/env"
 )
 
 // installCmd represents the install command
@@ -36,8 +39,8 @@ var installCmd = &cobra.Command{
     Use:   "install",
     Short: "Install resources to the cluster",
     Long:  `Install various resources like dependencies to the cluster.`,
-    Run: func(cmd *cobra.Command, args []string) {
-        cmd.Help()
+    RunE: func(cmd *cobra.Command, args []string) error {
+        return cmd.Help()
     },
 }
 
@@ -45,44 +48,59 @@ var installCmd = &cobra.Command{
 var dependencyCmd = &cobra.Command{
     Use:   "dependency [dependency-name]",
     Short: "Install a specific dependency",
-    Long:  `Install a specific dependency like PostgreSQL, Redis, etc. to the cluster.`,
+    Long:  `Install a specific dependency like PostgreSQL, Redis, etc. to the cluster,
+after everything it declares in depends_on.`,
     Args:  cobra.ExactArgs(1),
-    Run: func(cmd *cobra.Command, args []string) {
+    RunE: func(cmd *cobra.Command, args []string) error {
         depName := args[0]
         verbose, _ := cmd.Flags().GetBool("verbose")
+        dryRun, _ := cmd.Flags().GetBool("dry-run")
+        noDeps, _ := cmd.Flags().GetBool("no-deps")
         
         // Read dependencies configuration
         var deps map[string]deploy.DependencyConfig
         if err := viper.UnmarshalKey("dependencies", &deps); err != nil {
-            fmt.Printf("Error reading dependencies configuration: %v\n", err)
-            return
+            return config.Invalid("dependencies", err)
         }
         
         // Check if dependency exists in configuration
-        depConfig, exists := deps[depName]
-        if !exists {
-            fmt.Printf("Dependency '%s' not found in configuration\n", depName)
-            return
+        if _, exists := deps[depName]; !exists {
+            return &config.NotFoundError{Kind: "dependency", Name: depName}
+        }
+        
+        fullConfig, err := env.ReadConfig()
+        if err != nil {
+            return err
+        }
+        
+        // Flags override the release options and values of the dependency
+        if dep, ok := fullConfig.Dependencies[depName]; ok {
+            releaseFlags(cmd, &dep.ReleaseOptions)
+            dep.Overrides = valueFlags(cmd)
+            fullConfig.Dependencies[depName] = dep
         }
         
         var s *spinner.Spinner
-        if !verbose {
+        if !verbose && !dryRun {
             s = spinner.New(spinner.CharSets[14], 100*time.Millisecond)
             s.Suffix = fmt.Sprintf(" Installing dependency %s...", depName)
             s.Start()
         }
         
-        err := deploy.InstallDependency(depName, depConfig, verbose)
+        steps, err := env.Install(fullConfig, []string{env.DependencyNode(depName)}, !noDeps, verbose, progress(s))
         
-        if !verbose && s != nil {
+        if s != nil {
             s.Stop()
         }
         
+        if len(steps) > 1 {
+            env.PrintSummary(os.Stdout, steps)
+        }
         if err != nil {
-            fmt.Printf("Error installing dependency '%s': %v\n", depName, err)
-        } else {
-            fmt.Printf("Dependency '%s' installed successfully!\n", depName)
+            return fmt.Errorf("failed to install dependency '%s': %w", depName, err)
         }
+        fmt.Printf("Dependency '%s' installed successfully!\n", depName)
+        return nil
     },
 }
 
@@ -90,50 +108,125 @@ var dependencyCmd = &cobra.Command{
 var appCmd = &cobra.Command{
     Use:   "app [app-name]",
     Short: "Install an application",
-    Long:  `Install a specific application to the cluster.`,
+    Long:  `Install a specific application to the cluster, after everything it
+declares in depends_on.`,
     Args:  cobra.ExactArgs(1),
-    Run: func(cmd *cobra.Command, args []string) {
+    RunE: func(cmd *cobra.Command, args []string) error {
         appName := args[0]
         verbose, _ := cmd.Flags().GetBool("verbose")
+        dryRun, _ := cmd.Flags().GetBool("dry-run")
+        noDeps, _ := cmd.Flags().GetBool("no-deps")
         
         // Read configuration for the application
-        var config deploy.AppConfig
+        var appConfig deploy.AppConfig
         configKey := fmt.Sprintf("apps.%s", appName)
-        if err := viper.UnmarshalKey(configKey, &config); err != nil {
-            fmt.Printf("Error reading configuration for app '%s': %v\n", appName, err)
-            return
+        if err := viper.UnmarshalKey(configKey, &appConfig); err != nil {
+            return config.Invalid(configKey, err)
         }
         
         // Check if configuration exists
-        if config.ProjectPath == "" {
-            fmt.Printf("No configuration found for application '%s'\n", appName)
-            return
+        if appConfig.ProjectPath == "" {
+            return &config.NotFoundError{Kind: "application", Name: appName}
+        }
+        
+        fullConfig, err := env.ReadConfig()
+        if err != nil {
+            return err
+        }
+        
+        // Flags override the release options and values of the application
+        if app, ok := fullConfig.Apps[appName]; ok {
+            releaseFlags(cmd, &app.Install.ReleaseOptions)
+            app.Install.Overrides = valueFlags(cmd)
+            fullConfig.Apps[appName] = app
         }
         
         var s *spinner.Spinner
-        if !verbose {
+        if !verbose && !dryRun {
             s = spinner.New(spinner.CharSets[14], 100*time.Millisecond)
             s.Suffix = fmt.Sprintf(" Installing application %s...", appName)
             s.Start()
         }
         
-        err := deploy.InstallApp(config, appName, verbose)
+        steps, err := env.Install(fullConfig, []string{env.AppNode(appName)}, !noDeps, verbose, progress(s))
         
-        if !verbose && s != nil {
+        if s != nil {
             s.Stop()
         }
         
+        if len(steps) > 1 {
+            env.PrintSummary(os.Stdout, steps)
+        }
         if err != nil {
-            fmt.Printf("Error installing application: %v\n", err)
-        } else {
-            fmt.Printf("Application %s installed successfully!\n", appName)
+            return fmt.Errorf("failed to install application %s: %w", appName, err)
         }
+        fmt.Printf("Application %s installed successfully!\n", appName)
+        return nil
     },
 }
 
+// progress points the spinner at the install currently running
+func progress(s *spinner.Spinner) func(name string) {
+    return func(name string) {
+        if s == nil {
+            return
+        }
+        s.Lock()
+        s.Suffix = fmt.Sprintf(" %s...", name)
+        s.Unlock()
+    }
+}
+
+// releaseFlags applies the --wait, --timeout, --atomic and --wait-for-jobs
+// flags given on the command line on top of the configured options.
+func releaseFlags(cmd *cobra.Command, options *deploy.ReleaseOptions) {
+    flags := cmd.Flags()
+    if flags.Changed("wait") {
+        options.Wait, _ = flags.GetBool("wait")
+    }
+    if flags.Changed("timeout") {
+        options.Timeout, _ = flags.GetDuration("timeout")
+    }
+    if flags.Changed("atomic") {
+        options.Atomic, _ = flags.GetBool("atomic")
+    }
+    if flags.Changed("wait-for-jobs") {
+        options.WaitForJobs, _ = flags.GetBool("wait-for-jobs")
+    }
+}
+
+// valueFlags returns the --values, --set and --set-string flags, applied on
+// top of the configured values.
+func valueFlags(cmd *cobra.Command) deploy.ValueOverrides {
+    var overrides deploy.ValueOverrides
+    overrides.Files, _ = cmd.Flags().GetStringArray("values")
+    overrides.Set, _ = cmd.Flags().GetStringArray("set")
+    overrides.SetString, _ = cmd.Flags().GetStringArray("set-string")
+    return overrides
+}
+
+func addValueFlags(cmd *cobra.Command) {
+    cmd.Flags().StringArray("values", nil, "Values file applied after the configured values (can be repeated)")
+    cmd.Flags().StringArray("set", nil, "Value set on the command line, e.g. replicaCount=2 (can be repeated)")
+    cmd.Flags().StringArray("set-string", nil, "String value set on the command line (can be repeated)")
+}
+
+func addReleaseFlags(cmd *cobra.Command) {
+    cmd.Flags().Bool("wait", false, "Wait until the release's pods, services and deployments are ready")
+    cmd.Flags().Duration("timeout", 0, "How long Helm waits for the release (Helm default: 5m)")
+    cmd.Flags().Bool("atomic", false, "Roll the release back if it does not become ready (implies --wait)")
+    cmd.Flags().Bool("wait-for-jobs", false, "Also wait for the release's jobs to complete (implies --wait)")
+}
+
 func GetCommand() *cobra.Command {
     dependencyCmd.Flags().Bool("verbose", false, "Show Helm output")
     appCmd.Flags().Bool("verbose", false, "Show Helm output")
+    dependencyCmd.Flags().Bool("no-deps", false, "Do not install the dependencies declared in depends_on")
+    appCmd.Flags().Bool("no-deps", false, "Do not install the dependencies declared in depends_on")
+    addReleaseFlags(dependencyCmd)
+    addReleaseFlags(appCmd)
+    addValueFlags(dependencyCmd)
+    addValueFlags(appCmd)
     installCmd.AddCommand(dependencyCmd)
     installCmd.AddCommand(appCmd)
     return installCmd
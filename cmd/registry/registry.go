@@ -0,0 +1,172 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package registry
+
+import (
+    "fmt"
+    "os"
+    "text/tabwriter"
+    "time"
+
+    "github.com/spf13/cobra"
+    "go-cli/internal/cluster"
+    "go-cli/internal/registry"
+    "go-cli/internal/usage"
+)
+
+// registryCmd represents the registry command
+var registryCmd = &cobra.Command{
+    Use:   "registry",
+    Short: "Manage the images of the local registry",
+    Long:  `List and delete the images pushed to the local registry, and reclaim their disk space.`,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        return cmd.Help()
+    },
+}
+
+// listCmd represents the list subcommand
+var listCmd = &cobra.Command{
+    Use:   "list",
+    Short: "List the images of the local registry",
+    Long:  `List every repository and tag of the local registry, newest first.`,
+    Args:  cobra.NoArgs,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        client, _, err := newClient(cmd)
+        if err != nil {
+            return err
+        }
+
+        images, err := registry.List(client)
+        if err != nil {
+            return fmt.Errorf("failed to list images: %w", err)
+        }
+
+        w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(w, "REPOSITORY\tTAG\tCREATED\tDIGEST")
+        for _, image := range images {
+            created := "-"
+            if !image.Created.IsZero() {
+                created = image.Created.Local().Format(time.DateTime)
+            }
+            fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", image.Repository, image.Tag, created, shortDigest(image.Digest))
+        }
+        w.Flush()
+        return nil
+    },
+}
+
+// rmCmd represents the rm subcommand
+var rmCmd = &cobra.Command{
+    Use:   "rm <image:tag>",
+    Short: "Delete an image from the local registry",
+    Long: `Delete an image from the local registry. Other tags pointing at the same
+image are deleted too. Run 'registry gc' to reclaim the disk space.`,
+    Args: cobra.ExactArgs(1),
+    RunE: func(cmd *cobra.Command, args []string) error {
+        client, registryConfig, err := newClient(cmd)
+        if err != nil {
+            return err
+        }
+
+        repository, tag, err := registry.ParseReference(args[0], registryConfig.Address())
+        if err != nil {
+            return err
+        }
+
+        others, err := registry.Remove(client, repository, tag)
+        if err != nil {
+            return fmt.Errorf("failed to delete %s: %w", args[0], err)
+        }
+        fmt.Printf("Deleted %s:%s\n", repository, tag)
+        for _, other := range others {
+            fmt.Printf("Deleted %s:%s (same image)\n", repository, other)
+        }
+        return nil
+    },
+}
+
+// gcCmd represents the gc subcommand
+var gcCmd = &cobra.Command{
+    Use:   "gc",
+    Short: "Delete old images and reclaim disk space",
+    Long: `Keep only the --keep newest tags of every repository of the local registry,
+then run the registry garbage collection to free the disk space of the
+deleted images. The registry is stopped during the collection.`,
+    Args: cobra.NoArgs,
+    RunE: func(cmd *cobra.Command, args []string) error {
+        verbose, _ := cmd.Flags().GetBool("verbose")
+        keep, _ := cmd.Flags().GetInt("keep")
+        if keep < 0 {
+            return usage.Errorf("--keep must not be negative")
+        }
+
+        client, registryConfig, err := newClient(cmd)
+        if err != nil {
+            return err
+        }
+
+        deleted, err := registry.Prune(client, keep)
+        for _, image := range deleted {
+            fmt.Printf("Deleted %s\n", image)
+        }
+        if err != nil {
+            return fmt.Errorf("failed to delete old images: %w", err)
+        }
+
+        if err := registry.GarbageCollect(registryConfig.Name, registryConfig.Image, verbose); err != nil {
+            return err
+        }
+        fmt.Printf("Deleted %d image(s), registry garbage collected.\n", len(deleted))
+        return nil
+    },
+}
+
+// newClient returns a client of the configured registry, which only prints
+// deletions in dry-run mode.
+func newClient(cmd *cobra.Command) (*registry.Client, cluster.RegistryConfig, error) {
+    registryConfig, err := cluster.ReadRegistryConfig()
+    if err != nil {
+        return nil, registryConfig, err
+    }
+
+    client := registry.NewClient(registryConfig.Address())
+    if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+        client.DryRun = os.Stdout
+    }
+    return client, registryConfig, nil
+}
+
+func shortDigest(digest string) string {
+    if len(digest) > 19 {
+        return digest[:19]
+    }
+    return digest
+}
+
+func GetCommand() *cobra.Command {
+    gcCmd.Flags().Int("keep", 5, "Number of newest tags kept in every repository")
+    gcCmd.Flags().Bool("verbose", false, "Show the garbage collection output")
+    registryCmd.AddCommand(listCmd)
+    registryCmd.AddCommand(rmCmd)
+    registryCmd.AddCommand(gcCmd)
+    return registryCmd
+}
@@ -22,51 +22,146 @@ THE SOFTWARE.
 package cmd
 
 import (
+    "errors"
     "fmt"
     "os"
     "path/filepath"
+    "strings"
 
     "github.com/spf13/cobra"
     "github.com/spf13/viper"
     "go-cli/cmd/build"
     "go-cli/cmd/cluster"
+    "go-cli/cmd/config"
+    "go-cli/cmd/dev"
+    "go-cli/cmd/doctor"
+    "go-cli/cmd/env"
     "go-cli/cmd/install"
+    "go-cli/cmd/registry"
     "go-cli/cmd/uninstall"
+    internalbuild "go-cli/internal/build"
+    internalcluster "go-cli/internal/cluster"
+    internalconfig "go-cli/internal/config"
+    "go-cli/internal/deploy"
+    internaldoctor "go-cli/internal/doctor"
+    internalenv "go-cli/internal/env"
+    "go-cli/internal/graph"
+    "go-cli/internal/helm"
+    internalregistry "go-cli/internal/registry"
+    "go-cli/internal/runner"
+    "go-cli/internal/usage"
 )
 
 var cfgFile string
+var dryRun bool
+var kubeContext string
+var profile string
+
+// runLog records the output of the tools run by the command
+var runLog *runner.Log
+
+// configErr holds the error met while reading the config file, reported
+// once a command runs
+var configErr error
+
+// commandStarted is set once arguments and flags are validated, so errors
+// returned before that are usage errors
+var commandStarted bool
+
+// Exit codes of go-cli
+const (
+    exitOK          = 0
+    exitFailure     = 1
+    exitUsage       = 2
+    exitConfig      = 3
+    exitToolMissing = 4
+    exitToolFailed  = 5
+)
 
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
     Use:   "go-cli",
-    Short: "A brief description of your application",
-    Long: `A longer description that spans multiple lines and likely contains
-examples and usage of using your application. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-    // Uncomment the following line if your bare application
-    // has an action associated with it:
-    // Run: func(cmd *cobra.Command, args []string) { },
+    Short: "Build and deploy applications to a local k3d cluster",
+    Long: `Build applications with Docker and deploy them and their dependencies
+with Helm to a local k3d cluster, driven by a YAML configuration file.
+
+Exit codes:
+  0  success
+  1  command failed
+  2  invalid command line usage
+  3  invalid or missing configuration
+  4  required tool (docker, k3d, helm...) not installed
+  5  tool exited with an error`,
+    SilenceErrors: true,
+    SilenceUsage:  true,
+    PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+        commandStarted = true
+        // Commands annotated with an optional config report config errors themselves
+        if cmd.Annotations["config"] == "optional" {
+            return nil
+        }
+        if configErr != nil {
+            return configErr
+        }
+        // Help and shell completion work whatever the configuration points at
+        if cmd.Name() == "help" || cmd.Name() == cobra.ShellCompRequestCmd || strings.HasPrefix(cmd.CommandPath(), cmd.Root().Name()+" completion") {
+            return nil
+        }
+        return internalenv.Validate()
+    },
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-    err := RootCmd.Execute()
+    cmd, err := RootCmd.ExecuteC()
+    runLog.Close()
     if err != nil {
-        os.Exit(1)
+        code := exitCode(err)
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        if code == exitUsage {
+            fmt.Fprintf(os.Stderr, "Run '%s --help' for usage.\n", cmd.CommandPath())
+        }
+        os.Exit(code)
     }
 }
 
+// exitCode maps an error returned by a command to the exit code documented in RootCmd
+func exitCode(err error) int {
+    var notFound *internalconfig.NotFoundError
+    var invalid *internalconfig.InvalidError
+    var fileErr *internalconfig.FileError
+    var validation *internalconfig.ValidationError
+    var cycle *graph.CycleError
+    var missing *runner.ToolMissingError
+    var failed *runner.ToolFailedError
+    var usageErr *usage.Error
+
+    switch {
+    case err == nil:
+        return exitOK
+    case errors.As(err, &notFound), errors.As(err, &invalid), errors.As(err, &fileErr), errors.As(err, &validation), errors.As(err, &cycle):
+        return exitConfig
+    case errors.As(err, &missing):
+        return exitToolMissing
+    case errors.As(err, &failed):
+        return exitToolFailed
+    case errors.As(err, &usageErr), !commandStarted:
+        return exitUsage
+    }
+    return exitFailure
+}
+
 func init() {
-    cobra.OnInitialize(initConfig)
+    cobra.OnInitialize(initConfig, initRunner)
 
     // Here you will define your flags and configuration settings.
     // Cobra supports persistent flags, which, if defined here,
     // will be global for your application.
     RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.config/cli/config.yaml)")
+    RootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Print the commands and files that would be executed or written without running anything")
+    RootCmd.PersistentFlags().StringVar(&kubeContext, "kube-context", "", "Kubeconfig context Helm operations run against (default is the current context)")
+    RootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Configuration profile applied on top of the configuration (default is $"+internalconfig.ProfileEnv+")")
 
     // Cobra also supports local flags, which will only run
     // when this action is called directly.
@@ -77,6 +172,12 @@ func init() {
     RootCmd.AddCommand(build.GetCommand())
     RootCmd.AddCommand(install.GetCommand())
     RootCmd.AddCommand(uninstall.GetCommand())
+    RootCmd.AddCommand(dev.GetCommand())
+    RootCmd.AddCommand(env.GetUpCommand())
+    RootCmd.AddCommand(env.GetDownCommand())
+    RootCmd.AddCommand(doctor.GetCommand())
+    RootCmd.AddCommand(registry.GetCommand())
+    RootCmd.AddCommand(config.GetCommand())
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -103,12 +204,45 @@ func initConfig() {
 
     viper.AutomaticEnv() // read in environment variables that match
 
-    // If a config file is found, read it in.
-    if err := viper.ReadInConfig(); err != nil {
-        if cfgFile != "" {
-            fmt.Printf("Error reading config file '%s': %v\n", cfgFile, err)
-        }
-    } else {
-        fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+    if profile == "" {
+        profile = os.Getenv(internalconfig.ProfileEnv)
+    }
+
+    // Read the config file, then merge the project files and the selected profile in
+    if err := viper.ReadInConfig(); err != nil && cfgFile != "" {
+        configErr = &internalconfig.FileError{Path: cfgFile, Err: err}
+        return
+    }
+    if configErr = internalconfig.Load(profile); configErr != nil {
+        return
+    }
+    for _, path := range internalconfig.Files() {
+        fmt.Fprintln(os.Stderr, "Using config file:", path)
     }
+    if profile != "" {
+        fmt.Fprintln(os.Stderr, "Using profile:", profile)
+    }
+}
+
+// initRunner selects how the internal packages invoke docker, k3d and helm.
+func initRunner() {
+    // Tool output goes to a log file per run under the cache directory
+    if cacheDir, err := os.UserCacheDir(); err == nil {
+        runLog = runner.NewLog(filepath.Join(cacheDir, "cli", "logs"))
+    }
+
+    var r runner.Runner = runner.Exec{Log: runLog}
+    if dryRun {
+        r = &runner.DryRun{Out: os.Stdout}
+    }
+
+    internalbuild.SetRunner(r)
+    internalcluster.SetRunner(r)
+    deploy.SetRunner(r)
+    helm.SetRunner(r)
+    internalregistry.SetRunner(r)
+    deploy.SetKubeContext(kubeContext)
+
+    // Checks only query the host, they run for real even in dry-run mode
+    internaldoctor.SetRunner(runner.Exec{Log: runLog})
 }
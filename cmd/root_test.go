@@ -0,0 +1,69 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+    "errors"
+    "fmt"
+    "testing"
+
+    internalconfig "go-cli/internal/config"
+    "go-cli/internal/graph"
+    "go-cli/internal/runner"
+    "go-cli/internal/usage"
+)
+
+func TestExitCode(t *testing.T) {
+    tests := []struct {
+        name    string
+        err     error
+        started bool
+        want    int
+    }{
+        {name: "success", err: nil, started: true, want: exitOK},
+        {name: "plain error", err: errors.New("boom"), started: true, want: exitFailure},
+        {name: "error before the command started", err: errors.New("unknown flag: --nope"), started: false, want: exitUsage},
+        {name: "usage error", err: usage.Errorf("--keep must not be negative"), started: true, want: exitUsage},
+        {name: "not found", err: &internalconfig.NotFoundError{Kind: "application", Name: "api"}, started: true, want: exitConfig},
+        {name: "invalid", err: internalconfig.Required("cluster.name"), started: true, want: exitConfig},
+        {name: "file", err: &internalconfig.FileError{Path: "config.yaml", Err: errors.New("bad yaml")}, started: false, want: exitConfig},
+        {name: "validation", err: &internalconfig.ValidationError{}, started: true, want: exitConfig},
+        {name: "cycle", err: &graph.CycleError{Path: []string{"api", "db", "api"}}, started: true, want: exitConfig},
+        {name: "tool missing", err: &runner.ToolMissingError{Tool: "k3d", Err: errors.New("not found")}, started: true, want: exitToolMissing},
+        {name: "tool failed", err: &runner.ToolFailedError{Tool: "helm", ExitCode: 1}, started: true, want: exitToolFailed},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            defer func(started bool) { commandStarted = started }(commandStarted)
+            commandStarted = tt.started
+
+            err := tt.err
+            if err != nil {
+                err = fmt.Errorf("command failed: %w", tt.err)
+            }
+            if got := exitCode(err); got != tt.want {
+                t.Errorf("exitCode(%v) = %d, want %d", err, got, tt.want)
+            }
+        })
+    }
+}
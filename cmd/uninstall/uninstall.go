@@ -28,6 +28,7 @@ import (
     "github.com/spf13/cobra"
     "github.com/spf13/viper"
     "github.com/briandowns/spinner"
+    "go-cli/internal/config"
     "go-cli/internal/deploy"
 )
 
@@ -36,8 +37,8 @@ var uninstallCmd = &cobra.Command{
     Use:   "uninstall",
     Short: "Uninstall resources from the cluster",
     Long:  `Uninstall various resources like dependencies from the cluster.`,
-    Run: func(cmd *cobra.Command, args []string) {
-        cmd.Help()
+    RunE: func(cmd *cobra.Command, args []string) error {
+        return cmd.Help()
     },
 }
 
@@ -47,26 +48,25 @@ var dependencyCmd = &cobra.Command{
     Short: "Uninstall a specific dependency",
     Long:  `Uninstall a specific dependency like PostgreSQL, Redis, etc. from the cluster.`,
     Args:  cobra.ExactArgs(1),
-    Run: func(cmd *cobra.Command, args []string) {
+    RunE: func(cmd *cobra.Command, args []string) error {
         depName := args[0]
         verbose, _ := cmd.Flags().GetBool("verbose")
+        dryRun, _ := cmd.Flags().GetBool("dry-run")
         
         // Read dependencies configuration
         var deps map[string]deploy.DependencyConfig
         if err := viper.UnmarshalKey("dependencies", &deps); err != nil {
-            fmt.Printf("Error reading dependencies configuration: %v\n", err)
-            return
+            return config.Invalid("dependencies", err)
         }
         
         // Check if dependency exists in configuration
         depConfig, exists := deps[depName]
         if !exists {
-            fmt.Printf("Dependency '%s' not found in configuration\n", depName)
-            return
+            return &config.NotFoundError{Kind: "dependency", Name: depName}
         }
         
         var s *spinner.Spinner
-        if !verbose {
+        if !verbose && !dryRun {
             s = spinner.New(spinner.CharSets[14], 100*time.Millisecond)
             s.Suffix = fmt.Sprintf(" Uninstalling dependency %s...", depName)
             s.Start()
@@ -74,15 +74,15 @@ var dependencyCmd = &cobra.Command{
         
         err := deploy.UninstallDependency(depName, depConfig, verbose)
         
-        if !verbose && s != nil {
+        if s != nil {
             s.Stop()
         }
         
         if err != nil {
-            fmt.Printf("Error uninstalling dependency '%s': %v\n", depName, err)
-        } else {
-            fmt.Printf("Dependency '%s' uninstalled successfully!\n", depName)
+            return fmt.Errorf("failed to uninstall dependency '%s': %w", depName, err)
         }
+        fmt.Printf("Dependency '%s' uninstalled successfully!\n", depName)
+        return nil
     },
 }
 
@@ -92,42 +92,41 @@ var appCmd = &cobra.Command{
     Short: "Uninstall an application",
     Long:  `Uninstall a specific application from the cluster.`,
     Args:  cobra.ExactArgs(1),
-    Run: func(cmd *cobra.Command, args []string) {
+    RunE: func(cmd *cobra.Command, args []string) error {
         appName := args[0]
         verbose, _ := cmd.Flags().GetBool("verbose")
+        dryRun, _ := cmd.Flags().GetBool("dry-run")
         
         // Read configuration for the application
-        var config deploy.AppConfig
+        var appConfig deploy.AppConfig
         configKey := fmt.Sprintf("apps.%s", appName)
-        if err := viper.UnmarshalKey(configKey, &config); err != nil {
-            fmt.Printf("Error reading configuration for app '%s': %v\n", appName, err)
-            return
+        if err := viper.UnmarshalKey(configKey, &appConfig); err != nil {
+            return config.Invalid(configKey, err)
         }
         
         // Check if configuration exists
-        if config.ProjectPath == "" {
-            fmt.Printf("No configuration found for application '%s'\n", appName)
-            return
+        if appConfig.ProjectPath == "" {
+            return &config.NotFoundError{Kind: "application", Name: appName}
         }
         
         var s *spinner.Spinner
-        if !verbose {
+        if !verbose && !dryRun {
             s = spinner.New(spinner.CharSets[14], 100*time.Millisecond)
             s.Suffix = fmt.Sprintf(" Uninstalling application %s...", appName)
             s.Start()
         }
         
-        err := deploy.UninstallApp(config, appName, verbose)
+        err := deploy.UninstallApp(appConfig, appName, verbose)
         
-        if !verbose && s != nil {
+        if s != nil {
             s.Stop()
         }
         
         if err != nil {
-            fmt.Printf("Error uninstalling application: %v\n", err)
-        } else {
-            fmt.Printf("Application %s uninstalled successfully!\n", appName)
+            return fmt.Errorf("failed to uninstall application %s: %w", appName, err)
         }
+        fmt.Printf("Application %s uninstalled successfully!\n", appName)
+        return nil
     },
 }
 
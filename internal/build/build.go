@@ -23,38 +23,66 @@ package build
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+
+	cfg "go-cli/internal/config"
+	"go-cli/internal/runner"
 )
 
+var cmdRunner runner.Runner = runner.Exec{}
+
+// SetRunner replaces the runner used to invoke docker.
+func SetRunner(r runner.Runner) {
+	cmdRunner = r
+}
+
 type BuildConfig struct {
 	ProjectPath string            `mapstructure:"project_path"`
 	Build       BuildDetails      `mapstructure:"build"`
 }
 
 type BuildDetails struct {
-	ImageName  string   `mapstructure:"image_name"`
-	Dockerfile string   `mapstructure:"dockerfile"`
-	Context    string   `mapstructure:"context"`
-	BuildArgs  []string `mapstructure:"build_args,omitempty"`
+	ImageName  string        `mapstructure:"image_name"`
+	Dockerfile string        `mapstructure:"dockerfile"`
+	Context    string        `mapstructure:"context"`
+	BuildArgs  []string      `mapstructure:"build_args,omitempty"`
+	Tag        string        `mapstructure:"tag"`
+	Publish    PublishConfig `mapstructure:"publish"`
 }
 
 func Build(config BuildConfig, verbose bool) error {
+	if verbose {
+		return BuildWith(config, os.Stdout, os.Stderr)
+	}
+	return BuildWith(config, nil, nil)
+}
+
+// BuildWith builds and publishes the image, writing the tools' output to stdout
+// and stderr, or discarding it when they are nil.
+func BuildWith(config BuildConfig, stdout io.Writer, stderr io.Writer) error {
 	// Validate required fields
 	if config.Build.ImageName == "" {
-		return fmt.Errorf("image_name is required")
+		return cfg.Required("image_name")
 	}
 	if config.Build.Dockerfile == "" {
-		return fmt.Errorf("dockerfile is required")
+		return cfg.Required("dockerfile")
 	}
 	if config.Build.Context == "" {
-		return fmt.Errorf("context is required")
+		return cfg.Required("context")
+	}
+	if config.Build.Tag != "" && config.Build.Tag != TagGitSHA && config.Build.Tag != TagDigest {
+		return unknownTag(config.Build.Tag)
+	}
+	if m := config.Build.Publish.Mode; m != "" && m != PublishRegistry && m != PublishK3d {
+		return unknownPublishMode(m)
 	}
 
-	// Change to project directory
-	if err := os.Chdir(config.ProjectPath); err != nil {
-		return fmt.Errorf("failed to change to project directory '%s': %w", config.ProjectPath, err)
+	// Docker runs from the project directory, the process working directory is left untouched
+	projectDir, err := ProjectDir(config.ProjectPath)
+	if err != nil {
+		return err
 	}
 
 	// Build Docker command
@@ -76,16 +104,40 @@ func Build(config BuildConfig, verbose bool) error {
 	args = append(args, config.Build.Context)
 
 	// Execute Docker command
-	cmd := exec.Command("docker", args...)
-	
-	if verbose {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-	}
-	
-	if err := cmd.Run(); err != nil {
+	cmd := runner.CommandWith(stdout, stderr, "docker", args...)
+	cmd.Dir = projectDir
+
+	if err := cmdRunner.Run(cmd); err != nil {
 		return fmt.Errorf("docker build failed: %w", err)
 	}
 
-	return nil
+	// Add the content-addressed tag
+	local, err := LocalImage(config)
+	if err != nil {
+		return err
+	}
+	if local != config.Build.ImageName {
+		if err := cmdRunner.Run(runner.CommandWith(stdout, stderr, "docker", "tag", config.Build.ImageName, local)); err != nil {
+			return fmt.Errorf("docker tag failed: %w", err)
+		}
+	}
+
+	// Make the image available to the cluster
+	return publish(config.Build.Publish, local, stdout, stderr)
+}
+
+// ProjectDir returns the absolute path of a project directory, checking that it exists.
+func ProjectDir(path string) (string, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", cfg.Invalid("project_path", err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", cfg.Invalid("project_path", err)
+	}
+	if !info.IsDir() {
+		return "", cfg.Invalid("project_path", fmt.Errorf("'%s' is not a directory", path))
+	}
+	return dir, nil
 }
\ No newline at end of file
@@ -0,0 +1,178 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package build
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	cfg "go-cli/internal/config"
+	"go-cli/internal/runner"
+)
+
+func useRunner(t *testing.T, recorder runner.Runner) {
+	t.Helper()
+	SetRunner(recorder)
+	t.Cleanup(func() { SetRunner(runner.Exec{}) })
+}
+
+func TestBuild(t *testing.T) {
+	project := t.TempDir()
+	details := BuildDetails{ImageName: "api:local", Dockerfile: "Dockerfile", Context: "."}
+
+	tests := []struct {
+		name      string
+		details   func(d BuildDetails) BuildDetails
+		outputs   map[string]string
+		wantLines []string
+		wantErr   error
+	}{
+		{
+			name:      "defaults",
+			details:   func(d BuildDetails) BuildDetails { return d },
+			wantLines: []string{"docker build -t api:local -f Dockerfile ."},
+		},
+		{
+			name: "build args",
+			details: func(d BuildDetails) BuildDetails {
+				d.Context = "src"
+				d.BuildArgs = []string{"VERSION=1", "DEBUG=true"}
+				return d
+			},
+			wantLines: []string{"docker build -t api:local -f src/Dockerfile --build-arg VERSION=1 --build-arg DEBUG=true src"},
+		},
+		{
+			name: "git sha tag",
+			details: func(d BuildDetails) BuildDetails {
+				d.Tag = TagGitSHA
+				return d
+			},
+			outputs: map[string]string{"git rev-parse": "0123456789ab\n"},
+			wantLines: []string{
+				"docker build -t api:local -f Dockerfile .",
+				"git rev-parse --short=12 HEAD",
+				"docker tag api:local api:0123456789ab",
+			},
+		},
+		{
+			name: "digest tag pushed to registry",
+			details: func(d BuildDetails) BuildDetails {
+				d.Tag = TagDigest
+				d.Publish = PublishConfig{Mode: PublishRegistry, Registry: "localhost:5050"}
+				return d
+			},
+			outputs: map[string]string{"docker image inspect": "sha256:0123456789abcdef0123\n"},
+			wantLines: []string{
+				"docker build -t api:local -f Dockerfile .",
+				"docker image inspect --format '{{.Id}}' api:local",
+				"docker tag api:local api:sha256-0123456789ab",
+				"docker tag api:sha256-0123456789ab localhost:5050/api:sha256-0123456789ab",
+				"docker push localhost:5050/api:sha256-0123456789ab",
+			},
+		},
+		{
+			name: "pushed to registry",
+			details: func(d BuildDetails) BuildDetails {
+				d.Publish = PublishConfig{Mode: PublishRegistry, Registry: "localhost:5050"}
+				return d
+			},
+			wantLines: []string{
+				"docker build -t api:local -f Dockerfile .",
+				"docker tag api:local localhost:5050/api:local",
+				"docker push localhost:5050/api:local",
+			},
+		},
+		{
+			name: "imported into k3d",
+			details: func(d BuildDetails) BuildDetails {
+				d.Publish = PublishConfig{Mode: PublishK3d, Cluster: "dev"}
+				return d
+			},
+			wantLines: []string{
+				"docker build -t api:local -f Dockerfile .",
+				"k3d image import api:local --cluster dev",
+			},
+		},
+		{
+			name: "missing image name",
+			details: func(d BuildDetails) BuildDetails {
+				d.ImageName = ""
+				return d
+			},
+			wantErr: cfg.Required("image_name"),
+		},
+		{
+			name: "unknown tag strategy",
+			details: func(d BuildDetails) BuildDetails {
+				d.Tag = "semver"
+				return d
+			},
+			wantErr: unknownTag("semver"),
+		},
+		{
+			name: "git prints nothing",
+			details: func(d BuildDetails) BuildDetails {
+				d.Tag = TagGitSHA
+				return d
+			},
+			wantLines: []string{
+				"docker build -t api:local -f Dockerfile .",
+				"git rev-parse --short=12 HEAD",
+			},
+			wantErr: errors.New("failed to resolve git commit of '" + project + "': the command printed nothing"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &runner.Recorder{Stub: runner.StubPrefixes(tt.outputs)}
+			useRunner(t, recorder)
+
+			err := Build(BuildConfig{ProjectPath: project, Build: tt.details(details)}, false)
+			if (err == nil) != (tt.wantErr == nil) || (err != nil && err.Error() != tt.wantErr.Error()) {
+				t.Fatalf("Build() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := recorder.Lines(); !reflect.DeepEqual(got, tt.wantLines) {
+				t.Errorf("Build() ran\n%q\nwant\n%q", got, tt.wantLines)
+			}
+			for _, cmd := range recorder.Calls() {
+				if (cmd.Name == "docker" && cmd.Args[0] == "build" || cmd.Name == "git") && cmd.Dir != project {
+					t.Errorf("%s ran in %q, want %q", cmd, cmd.Dir, project)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildDryRun(t *testing.T) {
+	var out strings.Builder
+	useRunner(t, &runner.DryRun{Out: &out})
+
+	config := BuildConfig{ProjectPath: t.TempDir(), Build: BuildDetails{ImageName: "api:local", Dockerfile: "Dockerfile", Context: ".", Tag: TagDigest}}
+	if err := Build(config, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "$ docker tag api:local 'api:<digest>'\n") {
+		t.Errorf("dry run printed\n%s", out.String())
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	cfg "go-cli/internal/config"
+)
+
+// BuildAllError reports the builds that failed in BuildAll.
+type BuildAllError struct {
+	Failed []Result
+	Total  int
+}
+
+func (e *BuildAllError) Error() string {
+	return fmt.Sprintf("%d of %d applications failed to build", len(e.Failed), e.Total)
+}
+
+func (e *BuildAllError) Unwrap() []error {
+	var errs []error
+	for _, result := range e.Failed {
+		errs = append(errs, result.Err)
+	}
+	return errs
+}
+
+// Result is the outcome of one build run by BuildAll.
+type Result struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+// BuildAll builds the named apps with at most jobs builds running at once
+// (one per app when jobs <= 0). When out is set, the tools' output of every
+// build is written to it, each line prefixed with the app name.
+// onStart and onDone may be nil; they are called concurrently.
+// Results are returned in the order of names, along with a *BuildAllError
+// when any build failed.
+func BuildAll(configs map[string]BuildConfig, names []string, jobs int, out io.Writer, onStart func(name string), onDone func(Result)) ([]Result, error) {
+	if jobs <= 0 || jobs > len(names) {
+		jobs = len(names)
+	}
+
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+
+	var outMu sync.Mutex
+	results := make([]Result, len(names))
+	slots := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			if onStart != nil {
+				onStart(name)
+			}
+
+			var w *prefixWriter
+			if out != nil {
+				w = &prefixWriter{mu: &outMu, out: out, prefix: fmt.Sprintf("%-*s | ", width, name)}
+			}
+
+			start := time.Now()
+			var err error
+			if config, ok := configs[name]; !ok || config.ProjectPath == "" {
+				err = &cfg.NotFoundError{Kind: "application", Name: name}
+			} else if w != nil {
+				err = BuildWith(config, w, w)
+				w.Flush()
+			} else {
+				err = BuildWith(config, nil, nil)
+			}
+
+			results[i] = Result{Name: name, Duration: time.Since(start), Err: err}
+			if onDone != nil {
+				onDone(results[i])
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	var failed []Result
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	if len(failed) > 0 {
+		return results, &BuildAllError{Failed: failed, Total: len(results)}
+	}
+	return results, nil
+}
+
+// prefixWriter writes complete lines to a shared writer, each prefixed with
+// the name of the app producing them. A tool's stdout and stderr may write to
+// it concurrently.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+
+	bufMu sync.Mutex
+	buf   []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.bufMu.Lock()
+	defer w.bufMu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.writeLine(w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// Flush writes the last line when it does not end with a newline.
+func (w *prefixWriter) Flush() {
+	w.bufMu.Lock()
+	defer w.bufMu.Unlock()
+
+	if len(w.buf) > 0 {
+		w.writeLine(append(w.buf, '\n'))
+		w.buf = nil
+	}
+}
+
+func (w *prefixWriter) writeLine(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	io.WriteString(w.out, w.prefix)
+	w.out.Write(line)
+}
@@ -0,0 +1,85 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package build
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	cfg "go-cli/internal/config"
+	"go-cli/internal/runner"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := &prefixWriter{mu: &sync.Mutex{}, out: &out, prefix: "api | "}
+
+	fmt.Fprint(w, "step 1\nstep")
+	fmt.Fprint(w, " 2\n")
+	fmt.Fprint(w, "done")
+	if want := "api | step 1\napi | step 2\n"; out.String() != want {
+		t.Errorf("before Flush() output = %q, want %q", out.String(), want)
+	}
+
+	w.Flush()
+	if want := "api | step 1\napi | step 2\napi | done\n"; out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestBuildAllWithOutput(t *testing.T) {
+	// docker build writes an unterminated line, flushed once the build is over
+	useRunner(t, &runner.Recorder{Stub: func(cmd runner.Cmd) ([]byte, error) {
+		if cmd.Name == "docker" && cmd.Args[0] == "build" {
+			fmt.Fprint(cmd.Stdout, "#1 building\n#2 done")
+		}
+		return nil, nil
+	}})
+
+	details := BuildDetails{ImageName: "api:local", Dockerfile: "Dockerfile", Context: "."}
+	configs := map[string]BuildConfig{"api": {ProjectPath: t.TempDir(), Build: details}}
+
+	var out bytes.Buffer
+	var started []string
+	results, err := BuildAll(configs, []string{"api", "worker"}, 1, &out, func(name string) { started = append(started, name) }, nil)
+
+	var buildErr *BuildAllError
+	if !errors.As(err, &buildErr) || len(buildErr.Failed) != 1 || buildErr.Total != 2 {
+		t.Fatalf("BuildAll() error = %v, want 1 of 2 applications failed", err)
+	}
+	var notFound *cfg.NotFoundError
+	if !errors.As(err, &notFound) || notFound.Name != "worker" {
+		t.Errorf("BuildAll() error does not wrap the missing worker: %v", err)
+	}
+	if len(results) != 2 || results[0].Name != "api" || results[0].Err != nil || results[1].Name != "worker" {
+		t.Errorf("results = %+v", results)
+	}
+	if want := "api    | #1 building\napi    | #2 done\n"; out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+	if len(started) != 2 {
+		t.Errorf("started = %v, want both applications", started)
+	}
+}
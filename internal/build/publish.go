@@ -0,0 +1,190 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package build
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go-cli/internal/cluster"
+	cfg "go-cli/internal/config"
+	"go-cli/internal/runner"
+)
+
+// Publish modes making a built image available to the cluster
+const (
+	PublishRegistry = "registry"
+	PublishK3d      = "k3d"
+)
+
+type PublishConfig struct {
+	Mode     string `mapstructure:"mode"`
+	Registry string `mapstructure:"registry"`
+	Cluster  string `mapstructure:"cluster"`
+}
+
+func (p PublishConfig) registry() string {
+	if p.Registry == "" {
+		return cluster.RegistryAddress()
+	}
+	return p.Registry
+}
+
+func (p PublishConfig) cluster() string {
+	if p.Cluster == "" {
+		return cluster.ActiveName()
+	}
+	return p.Cluster
+}
+
+// Tag strategies deriving a content-addressed tag for each build
+const (
+	TagGitSHA = "git-sha"
+	TagDigest = "digest"
+)
+
+// LocalImage returns the image reference tagged on the host Docker daemon
+// once the image is built, according to the tag strategy of the app.
+func LocalImage(config BuildConfig) (string, error) {
+	repository, _ := SplitImageRef(config.Build.ImageName)
+
+	switch config.Build.Tag {
+	case "":
+		return config.Build.ImageName, nil
+	case TagGitSHA:
+		cmd := runner.Command(false, "git", "rev-parse", "--short=12", "HEAD")
+		cmd.Dir = config.ProjectPath
+		output, err := cmdRunner.Output(cmd)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve git commit of '%s': %w", config.ProjectPath, err)
+		}
+		tag, err := contentTag(output, TagGitSHA)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve git commit of '%s': %w", config.ProjectPath, err)
+		}
+		return repository + ":" + tag, nil
+	case TagDigest:
+		output, err := cmdRunner.Output(runner.Command(false, "docker", "image", "inspect", "--format", "{{.Id}}", config.Build.ImageName))
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve digest of image '%s': %w", config.Build.ImageName, err)
+		}
+		digest, err := contentTag(output, TagDigest)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve digest of image '%s': %w", config.Build.ImageName, err)
+		}
+		digest = strings.ReplaceAll(digest, ":", "-")
+		if len(digest) > len("sha256-")+12 {
+			digest = digest[:len("sha256-")+12]
+		}
+		return repository + ":" + digest, nil
+	default:
+		return "", unknownTag(config.Build.Tag)
+	}
+}
+
+func unknownTag(tag string) error {
+	return &cfg.InvalidError{Key: "tag", Reason: fmt.Sprintf("has unknown strategy '%s' (expected '%s' or '%s')", tag, TagGitSHA, TagDigest)}
+}
+
+func unknownPublishMode(mode string) error {
+	return &cfg.InvalidError{Key: "publish.mode", Reason: fmt.Sprintf("has unknown value '%s' (expected '%s' or '%s')", mode, PublishRegistry, PublishK3d)}
+}
+
+func contentTag(output []byte, strategy string) (string, error) {
+	if runner.IsDryRun(cmdRunner) {
+		return "<" + strategy + ">", nil
+	}
+	tag := strings.TrimSpace(string(output))
+	if tag == "" {
+		return "", errors.New("the command printed nothing")
+	}
+	return tag, nil
+}
+
+// ImageRef returns the image reference the cluster pulls once the image is published.
+func ImageRef(config BuildConfig) (string, error) {
+	local, err := LocalImage(config)
+	if err != nil {
+		return "", err
+	}
+	return publishedRef(config.Build.Publish, local)
+}
+
+func publishedRef(publish PublishConfig, local string) (string, error) {
+	switch publish.Mode {
+	case "", PublishK3d:
+		return local, nil
+	case PublishRegistry:
+		return publish.registry() + "/" + local, nil
+	default:
+		return "", unknownPublishMode(publish.Mode)
+	}
+}
+
+// SplitImageRef splits an image reference into its repository and tag.
+func SplitImageRef(ref string) (repository string, tag string) {
+	slash := strings.LastIndex(ref, "/")
+	colon := strings.LastIndex(ref, ":")
+	if colon <= slash {
+		return ref, "latest"
+	}
+	return ref[:colon], ref[colon+1:]
+}
+
+// Publish pushes the built image to the local registry or imports it into the
+// k3d cluster, according to the publish mode of the app.
+func Publish(config BuildConfig, verbose bool) error {
+	local, err := LocalImage(config)
+	if err != nil {
+		return err
+	}
+	if verbose {
+		return publish(config.Build.Publish, local, os.Stdout, os.Stderr)
+	}
+	return publish(config.Build.Publish, local, nil, nil)
+}
+
+func publish(config PublishConfig, local string, stdout io.Writer, stderr io.Writer) error {
+	ref, err := publishedRef(config, local)
+	if err != nil {
+		return err
+	}
+
+	switch config.Mode {
+	case PublishRegistry:
+		if err := cmdRunner.Run(runner.CommandWith(stdout, stderr, "docker", "tag", local, ref)); err != nil {
+			return fmt.Errorf("docker tag failed: %w", err)
+		}
+		if err := cmdRunner.Run(runner.CommandWith(stdout, stderr, "docker", "push", ref)); err != nil {
+			return fmt.Errorf("docker push failed: %w", err)
+		}
+	case PublishK3d:
+		if err := cmdRunner.Run(runner.CommandWith(stdout, stderr, "k3d", "image", "import", ref, "--cluster", config.cluster())); err != nil {
+			return fmt.Errorf("k3d image import failed: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -22,143 +22,303 @@ THE SOFTWARE.
 package cluster
 
 import (
+    "encoding/json"
+    "errors"
     "fmt"
     "os"
-    "os/exec"
     "path/filepath"
     "strings"
+
+    "go-cli/internal/runner"
 )
 
-func ensureRegistryRunning(verbose bool) error {
-    // Check if registry already exists (running or stopped)
-    checkExistsCmd := exec.Command("docker", "ps", "-a", "-q", "-f", "name=local-registry")
-    existsOutput, _ := checkExistsCmd.Output()
-    
-    if len(strings.TrimSpace(string(existsOutput))) > 0 {
-        // Registry exists, check if it's running
-        checkRunningCmd := exec.Command("docker", "ps", "-q", "-f", "name=local-registry")
-        runningOutput, _ := checkRunningCmd.Output()
+var cmdRunner runner.Runner = runner.Exec{}
+
+
+// SetRunner replaces the runner used to invoke docker and k3d.
+func SetRunner(r runner.Runner) {
+    cmdRunner = r
+}
+
+// ensureRegistryRunning creates or starts the registry and its proxies.
+func ensureRegistryRunning(registry RegistryConfig, verbose bool) error {
+    containers, err := registry.containers()
+    if err != nil {
+        return err
+    }
+    for _, container := range containers {
+        // Check if registry already exists (running or stopped)
+        filter := "name=^" + container.name + "$"
+        existsOutput, _ := cmdRunner.Output(runner.Command(false, "docker", "ps", "-a", "-q", "-f", filter))
         
-        if len(strings.TrimSpace(string(runningOutput))) == 0 {
-            // Registry exists but is stopped, start it
-            startCmd := exec.Command("docker", "start", "local-registry")
-            if verbose {
-                startCmd.Stdout = os.Stdout
-                startCmd.Stderr = os.Stderr
+        if len(strings.TrimSpace(string(existsOutput))) > 0 {
+            // Registry exists, check if it's running
+            runningOutput, _ := cmdRunner.Output(runner.Command(false, "docker", "ps", "-q", "-f", filter))
+            
+            if len(strings.TrimSpace(string(runningOutput))) == 0 {
+                // Registry exists but is stopped, start it
+                if err := cmdRunner.Run(runner.Command(verbose, "docker", "start", container.name)); err != nil {
+                    return fmt.Errorf("failed to start existing registry %s: %w", container.name, err)
+                }
             }
-            if err := startCmd.Run(); err != nil {
-                return fmt.Errorf("failed to start existing registry: %w", err)
+        } else {
+            // Registry doesn't exist, create it
+            registryCmd := runner.Command(verbose, "docker", container.args...)
+            registryCmd.Env = container.env
+            
+            if err := cmdRunner.Run(registryCmd); err != nil {
+                return fmt.Errorf("docker registry creation failed for %s: %w", container.name, err)
             }
         }
-    } else {
-        // Registry doesn't exist, create it
-        registryCmd := exec.Command("docker", "run", "-d", "--name", "local-registry", "-p", "5000:5000", "--restart=always", "registry:2")
-        
-        if verbose {
-            registryCmd.Stdout = os.Stdout
-            registryCmd.Stderr = os.Stderr
-        }
-        
-        if err := registryCmd.Run(); err != nil {
-            return fmt.Errorf("docker registry creation failed: %w", err)
-        }
     }
     
     return nil
 }
 
-func stopRegistry(verbose bool) error {
-    stopCmd := exec.Command("docker", "stop", "local-registry")
-    if verbose {
-        stopCmd.Stdout = os.Stdout
-        stopCmd.Stderr = os.Stderr
+func stopRegistry(registry RegistryConfig, verbose bool) error {
+    for _, name := range registry.containerNames() {
+        cmdRunner.Run(runner.Command(verbose, "docker", "stop", name)) // Ignore errors if registry doesn't exist
     }
-    stopCmd.Run() // Ignore errors if registry doesn't exist
     return nil
 }
 
-func removeRegistryContainer(verbose bool) error {
-    removeCmd := exec.Command("docker", "rm", "local-registry")
-    if verbose {
-        removeCmd.Stdout = os.Stdout
-        removeCmd.Stderr = os.Stderr
+func removeRegistryContainer(registry RegistryConfig, verbose bool) error {
+    for _, name := range registry.containerNames() {
+        cmdRunner.Run(runner.Command(verbose, "docker", "rm", name)) // Ignore errors if registry doesn't exist
     }
-    removeCmd.Run() // Ignore errors if registry doesn't exist
     return nil
 }
 
-func Create(verbose bool) error {
+// Info summarizes a k3d cluster as reported by k3d cluster list.
+type Info struct {
+    Name           string `json:"name"`
+    Servers        int    `json:"serversCount"`
+    ServersRunning int    `json:"serversRunning"`
+    Agents         int    `json:"agentsCount"`
+    AgentsRunning  int    `json:"agentsRunning"`
+    Nodes          []Node `json:"nodes"`
+}
+
+// Node is a container running a k3s server, agent or the cluster load balancer.
+type Node struct {
+    Name  string `json:"name"`
+    Role  string `json:"role"`
+    State struct {
+        Running bool   `json:"Running"`
+        Status  string `json:"Status"`
+    } `json:"State"`
+}
+
+// Running reports whether the servers of the cluster are running.
+func (i Info) Running() bool {
+    return i.Servers > 0 && i.ServersRunning == i.Servers
+}
+
+// List returns the k3d clusters present on the host. It returns nil in
+// dry-run mode, where the command is only printed.
+func List() ([]Info, error) {
+    output, err := cmdRunner.Output(runner.Command(false, "k3d", "cluster", "list", "-o", "json"))
+    if err != nil {
+        return nil, fmt.Errorf("k3d cluster list failed: %w", err)
+    }
+    if DryRun() {
+        return nil, nil
+    }
+    if len(strings.TrimSpace(string(output))) == 0 {
+        return nil, errors.New("k3d cluster list printed nothing")
+    }
+
+    clusters := []Info{}
+    if err := json.Unmarshal(output, &clusters); err != nil {
+        return nil, fmt.Errorf("failed to parse k3d cluster list: %w", err)
+    }
+    return clusters, nil
+}
+
+// DryRun reports whether k3d is only printed, in which case List returns no
+// cluster and Exists always reports false.
+func DryRun() bool {
+    return runner.IsDryRun(cmdRunner)
+}
+
+// Exists reports whether the k3d cluster named name is present.
+func Exists(name string) (bool, error) {
+    clusters, err := List()
+    if err != nil {
+        return false, err
+    }
+    return contains(clusters, name), nil
+}
+
+// Get returns the k3d cluster named name, or nil when it does not exist.
+func Get(name string) (*Info, error) {
+    clusters, err := List()
+    if err != nil {
+        return nil, err
+    }
+    for i := range clusters {
+        if clusters[i].Name == name {
+            return &clusters[i], nil
+        }
+    }
+    return nil, nil
+}
+
+func contains(clusters []Info, name string) bool {
+    for _, c := range clusters {
+        if c.Name == name {
+            return true
+        }
+    }
+    return false
+}
+
+// Use switches the kubeconfig context to the cluster named name and records
+// it as the active cluster targeted by the other commands.
+func Use(name string, verbose bool) error {
+    clusters, err := List()
+    if err != nil {
+        return err
+    }
+    if !DryRun() && !contains(clusters, name) {
+        return fmt.Errorf("cluster '%s' does not exist, see 'go-cli cluster list'", name)
+    }
+
+    if err := cmdRunner.Run(runner.Command(verbose, "k3d", "kubeconfig", "merge", name, "--kubeconfig-switch-context")); err != nil {
+        return fmt.Errorf("failed to switch kubeconfig context: %w", err)
+    }
+    return setActive(name)
+}
+
+// Active returns the name of the cluster recorded by Use or Create, or an
+// empty string when none is.
+func Active() string {
+    path, err := activePath()
+    if err != nil {
+        return ""
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return ""
+    }
+    return strings.TrimSpace(string(data))
+}
+
+func setActive(name string) error {
+    path, err := activePath()
+    if err != nil {
+        return err
+    }
+    if err := cmdRunner.WriteFile(path, []byte(name+"\n"), 0644); err != nil {
+        return fmt.Errorf("failed to record the active cluster: %w", err)
+    }
+    return nil
+}
+
+func activePath() (string, error) {
+    cacheDir, err := os.UserCacheDir()
+    if err != nil {
+        return "", fmt.Errorf("failed to get user cache directory: %w", err)
+    }
+    return filepath.Join(cacheDir, "cli", "active-cluster"), nil
+}
+
+func Create(config Config, verbose bool) error {
     // Get user cache directory
     cacheDir, err := os.UserCacheDir()
     if err != nil {
         return fmt.Errorf("failed to get user cache directory: %w", err)
     }
 
-    // Create CLI cache directory if it doesn't exist
-    cliCacheDir := filepath.Join(cacheDir, "cli")
-    if err := os.MkdirAll(cliCacheDir, 0755); err != nil {
-        return fmt.Errorf("failed to create CLI cache directory: %w", err)
-    }
-
-    // Generate registry configuration file
-    registryConfigPath := filepath.Join(cliCacheDir, "registry.yaml")
-    registryConfig := `mirrors:
-  "localhost:5000":
-    endpoint:
-      - "http://localhost:5000"
-configs:
-  "localhost:5000":
-    auth:
-      username: ""
-      password: ""
-    tls:
-      insecure_skip_verify: true
-`
-
-    if err := os.WriteFile(registryConfigPath, []byte(registryConfig), 0644); err != nil {
+    // Generate registry configuration file in the CLI cache directory
+    registryConfigPath := filepath.Join(cacheDir, "cli", "registry.yaml")
+
+    if err := cmdRunner.WriteFile(registryConfigPath, []byte(config.Registry.mirrors()), 0644); err != nil {
         return fmt.Errorf("failed to write registry configuration: %w", err)
     }
 
     // Ensure Docker registry is running
-    if err := ensureRegistryRunning(verbose); err != nil {
+    if err := ensureRegistryRunning(config.Registry, verbose); err != nil {
         return err
     }
 
     // Create k3d cluster with registry configuration
-    cmd := exec.Command("k3d", "cluster", "create", "local", "--registry-config", registryConfigPath)
+    cmd := runner.Command(verbose, "k3d", config.createArgs(registryConfigPath)...)
 
-    if verbose {
-        cmd.Stdout = os.Stdout
-        cmd.Stderr = os.Stderr
-    }
-
-    if err := cmd.Run(); err != nil {
+    if err := cmdRunner.Run(cmd); err != nil {
         return fmt.Errorf("k3d cluster creation failed: %w", err)
     }
 
-    return nil
+    // k3d switched the kubeconfig context to the new cluster
+    return setActive(config.Name)
 }
 
-func Delete(verbose bool, removeRegistry bool) error {
-    // Delete k3d cluster named "local"
-    cmd := exec.Command("k3d", "cluster", "delete", "local")
+// Delete deletes the cluster and reports whether the registry was stopped,
+// which only happens once no cluster remains.
+func Delete(config Config, verbose bool, removeRegistry bool) (bool, error) {
+    // Delete k3d cluster
+    cmd := runner.Command(verbose, "k3d", "cluster", "delete", config.Name)
 
-    if verbose {
-        cmd.Stdout = os.Stdout
-        cmd.Stderr = os.Stderr
+    if err := cmdRunner.Run(cmd); err != nil {
+        return false, fmt.Errorf("k3d cluster deletion failed: %w", err)
+    }
+
+    // The default cluster becomes active again
+    if Active() == config.Name {
+        if err := setActive(""); err != nil {
+            return false, err
+        }
     }
 
-    if err := cmd.Run(); err != nil {
-        return fmt.Errorf("k3d cluster deletion failed: %w", err)
+    // The registry is shared, it keeps running while other clusters remain
+    remaining, err := List()
+    if err != nil {
+        return false, err
+    }
+    if len(remaining) > 0 {
+        return false, nil
     }
 
     // Stop local Docker registry
-    stopRegistry(verbose)
+    stopRegistry(config.Registry, verbose)
 
     // Remove registry only if --remove-registry flag is set
     if removeRegistry {
-        removeRegistryContainer(verbose)
+        removeRegistryContainer(config.Registry, verbose)
     }
 
+    return true, nil
+}
+
+// Start starts the registry and the stopped cluster.
+func Start(config Config, verbose bool) error {
+    if err := ensureRegistryRunning(config.Registry, verbose); err != nil {
+        return err
+    }
+
+    if err := cmdRunner.Run(runner.Command(verbose, "k3d", "cluster", "start", config.Name)); err != nil {
+        return fmt.Errorf("k3d cluster start failed: %w", err)
+    }
     return nil
 }
+
+// Stop stops the cluster and reports whether the registry was stopped, which
+// only happens once no other cluster is running.
+func Stop(config Config, verbose bool) (bool, error) {
+    if err := cmdRunner.Run(runner.Command(verbose, "k3d", "cluster", "stop", config.Name)); err != nil {
+        return false, fmt.Errorf("k3d cluster stop failed: %w", err)
+    }
+
+    clusters, err := List()
+    if err != nil {
+        return false, err
+    }
+    for _, c := range clusters {
+        if c.Name != config.Name && c.ServersRunning > 0 {
+            return false, nil
+        }
+    }
+
+    stopRegistry(config.Registry, verbose)
+    return true, nil
+}
@@ -0,0 +1,241 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cluster
+
+import (
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+
+    "github.com/spf13/viper"
+    "go-cli/internal/runner"
+)
+
+// useRecorder records the commands in a cache directory of its own.
+func useRecorder(t *testing.T, outputs map[string]string) (*runner.Recorder, string) {
+    t.Helper()
+    cacheDir := t.TempDir()
+    t.Setenv("XDG_CACHE_HOME", cacheDir)
+
+    recorder := &runner.Recorder{Stub: runner.StubPrefixes(outputs)}
+    SetRunner(recorder)
+    t.Cleanup(func() { SetRunner(runner.Exec{}) })
+    return recorder, filepath.Join(cacheDir, "cli")
+}
+
+func TestReadConfigAPIPort(t *testing.T) {
+    t.Setenv("XDG_CACHE_HOME", t.TempDir())
+    t.Cleanup(viper.Reset)
+
+    tests := []struct {
+        name    string
+        cluster map[string]any
+        read    string
+        want    int
+    }{
+        {name: "picked by k3d", cluster: map[string]any{"name": "local"}, want: 0},
+        {name: "configured", cluster: map[string]any{"name": "local", "api_port": 6551}, want: 6551},
+        {name: "other cluster", cluster: map[string]any{"name": "local", "api_port": 6551}, read: "other", want: 0},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            viper.Reset()
+            viper.Set("cluster", tt.cluster)
+
+            config, err := ReadConfig(tt.read)
+            if err != nil {
+                t.Fatalf("ReadConfig() error = %v", err)
+            }
+            if config.APIPort != tt.want {
+                t.Errorf("APIPort = %d, want %d", config.APIPort, tt.want)
+            }
+        })
+    }
+}
+
+func TestCreate(t *testing.T) {
+    tests := []struct {
+        name      string
+        config    func(c Config) Config
+        outputs   map[string]string
+        wantLines []string
+    }{
+        {
+            name:   "default",
+            config: func(c Config) Config { return c },
+            wantLines: []string{
+                "docker ps -a -q -f 'name=^local-registry$'",
+                "docker run -d --name local-registry -p 5000:5000 --restart=always -e REGISTRY_STORAGE_DELETE_ENABLED=true registry:2",
+                "k3d cluster create local --registry-config {config}",
+            },
+        },
+        {
+            name: "shape and stopped registry",
+            config: func(c Config) Config {
+                c.Name = "k8s-128"
+                c.APIPort = 6551
+                c.KubernetesVersion = "1.28.4"
+                c.Servers = 3
+                c.Agents = 2
+                c.Ports = []string{"8080:80@loadbalancer"}
+                c.K3sArgs = []string{"--tls-san=dev.local", "--node-taint=x@agent:*"}
+                c.Disable = []string{"traefik"}
+                return c
+            },
+            outputs: map[string]string{"docker ps -a": "0123abcd\n"},
+            wantLines: []string{
+                "docker ps -a -q -f 'name=^local-registry$'",
+                "docker ps -q -f 'name=^local-registry$'",
+                "docker start local-registry",
+                "k3d cluster create k8s-128 --registry-config {config} --api-port 6551 --image rancher/k3s:v1.28.4-k3s1 --servers 3 --agents 2" +
+                    " --port 8080:80@loadbalancer --k3s-arg '--tls-san=dev.local@server:*' --k3s-arg '--node-taint=x@agent:*'" +
+                    " --k3s-arg '--disable=traefik@server:*'",
+            },
+        },
+        {
+            name:    "running registry",
+            config:  func(c Config) Config { return c },
+            outputs: map[string]string{"docker ps": "0123abcd\n"},
+            wantLines: []string{
+                "docker ps -a -q -f 'name=^local-registry$'",
+                "docker ps -q -f 'name=^local-registry$'",
+                "k3d cluster create local --registry-config {config}",
+            },
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            recorder, cacheDir := useRecorder(t, tt.outputs)
+            config := tt.config(DefaultConfig())
+            registryConfig := filepath.Join(cacheDir, "registry.yaml")
+
+            if err := Create(config, false); err != nil {
+                t.Fatal(err)
+            }
+
+            var want []string
+            for _, line := range tt.wantLines {
+                want = append(want, strings.ReplaceAll(line, "{config}", registryConfig))
+            }
+            if got := recorder.Lines(); !reflect.DeepEqual(got, want) {
+                t.Errorf("Create() ran\n%q\nwant\n%q", got, want)
+            }
+            if got, _ := recorder.File(registryConfig); string(got) != config.Registry.mirrors() {
+                t.Errorf("registry.yaml =\n%s\nwant\n%s", got, config.Registry.mirrors())
+            }
+            if got, _ := recorder.File(filepath.Join(cacheDir, "active-cluster")); string(got) != config.Name+"\n" {
+                t.Errorf("active cluster = %q, want %q", got, config.Name+"\n")
+            }
+        })
+    }
+}
+
+func TestDelete(t *testing.T) {
+    tests := []struct {
+        name           string
+        clusters       string
+        removeRegistry bool
+        wantLines      []string
+        wantStopped    bool
+    }{
+        {
+            name:        "last cluster",
+            clusters:    `[]`,
+            wantLines:   []string{"k3d cluster delete local", "k3d cluster list -o json", "docker stop local-registry"},
+            wantStopped: true,
+        },
+        {
+            name:           "last cluster removing the registry",
+            clusters:       `[]`,
+            removeRegistry: true,
+            wantLines:      []string{"k3d cluster delete local", "k3d cluster list -o json", "docker stop local-registry", "docker rm local-registry"},
+            wantStopped:    true,
+        },
+        {
+            name:           "other cluster left",
+            clusters:       `[{"name":"k8s-128","serversCount":1,"serversRunning":1}]`,
+            removeRegistry: true,
+            wantLines:      []string{"k3d cluster delete local", "k3d cluster list -o json"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            recorder, _ := useRecorder(t, map[string]string{"k3d cluster list": tt.clusters})
+
+            stopped, err := Delete(DefaultConfig(), false, tt.removeRegistry)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if stopped != tt.wantStopped {
+                t.Errorf("Delete() = %v, want %v", stopped, tt.wantStopped)
+            }
+            if got := recorder.Lines(); !reflect.DeepEqual(got, tt.wantLines) {
+                t.Errorf("Delete() ran\n%q\nwant\n%q", got, tt.wantLines)
+            }
+        })
+    }
+}
+
+func TestList(t *testing.T) {
+    tests := []struct {
+        name    string
+        output  string
+        want    []string
+        wantErr bool
+    }{
+        {name: "clusters", output: `[{"name":"local"},{"name":"k8s-128"}]`, want: []string{"local", "k8s-128"}},
+        {name: "no cluster", output: "[]\n", want: nil},
+        {name: "no output", output: "", wantErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            useRecorder(t, map[string]string{"k3d cluster list": tt.output})
+
+            clusters, err := List()
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("List() error = %v, wantErr %v", err, tt.wantErr)
+            }
+            var names []string
+            for _, c := range clusters {
+                names = append(names, c.Name)
+            }
+            if !reflect.DeepEqual(names, tt.want) {
+                t.Errorf("List() = %v, want %v", names, tt.want)
+            }
+        })
+    }
+}
+
+func TestListDryRun(t *testing.T) {
+    var out strings.Builder
+    SetRunner(&runner.DryRun{Out: &out})
+    t.Cleanup(func() { SetRunner(runner.Exec{}) })
+
+    clusters, err := List()
+    if err != nil || clusters != nil {
+        t.Errorf("List() = %v, %v, want no cluster", clusters, err)
+    }
+    if out.String() != "$ k3d cluster list -o json\n" {
+        t.Errorf("dry run printed %q", out.String())
+    }
+}
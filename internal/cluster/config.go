@@ -0,0 +1,229 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cluster
+
+import (
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "github.com/spf13/viper"
+    cfg "go-cli/internal/config"
+)
+
+// Config describes a k3d cluster, read from the cluster or clusters sections of the configuration.
+type Config struct {
+    Name string `mapstructure:"name"`
+    // Image is the k3s node image, KubernetesVersion a shortcut selecting it
+    Image             string `mapstructure:"image"`
+    KubernetesVersion string `mapstructure:"kubernetes_version"`
+    Servers           int    `mapstructure:"servers"`
+    Agents            int    `mapstructure:"agents"`
+    // APIPort is the host port of the Kubernetes API, a free one is picked when zero
+    APIPort int `mapstructure:"api_port"`
+    // Ports and Volumes use the k3d syntax, e.g. 8080:80@loadbalancer and /src:/src@all
+    Ports   []string `mapstructure:"ports"`
+    Volumes []string `mapstructure:"volumes"`
+    // K3sArgs are passed to k3s, on every server unless a node filter follows '@'
+    K3sArgs []string `mapstructure:"k3s_args"`
+    // Disable lists the k3s components not deployed, e.g. traefik
+    Disable []string `mapstructure:"disable"`
+
+    // Registry is read from the registry section, shared by every cluster
+    Registry RegistryConfig `mapstructure:"-"`
+}
+
+// DefaultName is the name of the cluster when none is configured
+const DefaultName = "local"
+
+var namePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// ReadConfig returns the shape of the cluster named name, or of the active
+// cluster when name is empty. The cluster section describes the default
+// cluster and the clusters section additional ones. Other names get the shape
+// of the default cluster without its host ports, which would conflict.
+func ReadConfig(name string) (Config, error) {
+    var config Config
+    if err := viper.UnmarshalKey("cluster", &config); err != nil {
+        return config, cfg.Invalid("cluster", err)
+    }
+    if config.Name == "" {
+        config.Name = DefaultName
+    }
+
+    if name == "" {
+        name = Active()
+    }
+    if name != "" && name != config.Name {
+        var clusters map[string]Config
+        if err := viper.UnmarshalKey("clusters", &clusters); err != nil {
+            return config, cfg.Invalid("clusters", err)
+        }
+        if named, ok := clusters[name]; ok {
+            config = named
+        } else {
+            config.APIPort = 0
+            config.Ports = nil
+        }
+        config.Name = name
+    }
+
+    registry, err := ReadRegistryConfig()
+    if err != nil {
+        return config, err
+    }
+    config.Registry = registry
+    return config, config.validate()
+}
+
+// DefaultConfig returns the shape of the default cluster when nothing is configured.
+func DefaultConfig() Config {
+    return Config{
+        Name: DefaultName,
+        Registry: RegistryConfig{
+            Name:    DefaultRegistryName,
+            Port:    DefaultRegistryPort,
+            Image:   DefaultRegistryImage,
+            Restart: DefaultRegistryRestart,
+        },
+    }
+}
+
+// ActiveName returns the name of the active cluster, or of the default one
+// when the configuration cannot be read.
+func ActiveName() string {
+    config, err := ReadConfig("")
+    if err != nil {
+        return DefaultName
+    }
+    return config.Name
+}
+
+// KubeContext returns the kubeconfig context k3d creates for the cluster named name.
+func KubeContext(name string) string {
+    return "k3d-" + name
+}
+
+func (c Config) validate() error {
+    if len(c.Name) > 32 || !namePattern.MatchString(c.Name) {
+        return &cfg.InvalidError{Key: "cluster.name", Reason: fmt.Sprintf("has invalid value '%s' (expected at most 32 lowercase letters, digits or '-')", c.Name)}
+    }
+    if c.Image != "" && c.KubernetesVersion != "" {
+        return &cfg.InvalidError{Key: "cluster.kubernetes_version", Reason: "cannot be set together with cluster.image"}
+    }
+    if c.Servers < 0 {
+        return &cfg.InvalidError{Key: "cluster.servers", Reason: "must not be negative"}
+    }
+    if c.Agents < 0 {
+        return &cfg.InvalidError{Key: "cluster.agents", Reason: "must not be negative"}
+    }
+    if c.APIPort < 0 || c.APIPort > 65535 {
+        return &cfg.InvalidError{Key: "cluster.api_port", Reason: fmt.Sprintf("has invalid port %d", c.APIPort)}
+    }
+    for _, port := range c.Ports {
+        if _, err := HostPort(port); err != nil {
+            return cfg.Invalid("cluster.ports", err)
+        }
+    }
+    for _, volume := range c.Volumes {
+        if !strings.Contains(volume, ":") {
+            return &cfg.InvalidError{Key: "cluster.volumes", Reason: fmt.Sprintf("has invalid value '%s' (expected host-path:node-path[@node-filter])", volume)}
+        }
+    }
+    return nil
+}
+
+// ContainerPrefix returns the prefix of the names of the containers k3d runs for the cluster.
+func (c Config) ContainerPrefix() string {
+    return "k3d-" + c.Name + "-"
+}
+
+// image returns the k3s node image selected by Image or KubernetesVersion.
+func (c Config) image() string {
+    if c.Image != "" || c.KubernetesVersion == "" {
+        return c.Image
+    }
+    version := c.KubernetesVersion
+    if !strings.HasPrefix(version, "v") {
+        version = "v" + version
+    }
+    if !strings.Contains(version, "-k3s") {
+        version += "-k3s1"
+    }
+    return "rancher/k3s:" + version
+}
+
+// createArgs returns the k3d arguments creating the cluster.
+func (c Config) createArgs(registryConfigPath string) []string {
+    args := []string{"cluster", "create", c.Name, "--registry-config", registryConfigPath}
+    // Without an API port, k3d picks a free one
+    if c.APIPort != 0 {
+        args = append(args, "--api-port", strconv.Itoa(c.APIPort))
+    }
+    if image := c.image(); image != "" {
+        args = append(args, "--image", image)
+    }
+    if c.Servers > 0 {
+        args = append(args, "--servers", strconv.Itoa(c.Servers))
+    }
+    if c.Agents > 0 {
+        args = append(args, "--agents", strconv.Itoa(c.Agents))
+    }
+    for _, port := range c.Ports {
+        args = append(args, "--port", port)
+    }
+    for _, volume := range c.Volumes {
+        args = append(args, "--volume", volume)
+    }
+    for _, arg := range c.K3sArgs {
+        args = append(args, "--k3s-arg", withNodeFilter(arg))
+    }
+    for _, component := range c.Disable {
+        args = append(args, "--k3s-arg", withNodeFilter("--disable="+component))
+    }
+    return args
+}
+
+// withNodeFilter applies a k3s argument to every server unless it names its nodes.
+func withNodeFilter(arg string) string {
+    if strings.Contains(arg, "@") {
+        return arg
+    }
+    return arg + "@server:*"
+}
+
+// HostPort returns the host port of a k3d port mapping such as
+// 8080:80@loadbalancer or 127.0.0.1:8080:80.
+func HostPort(mapping string) (int, error) {
+    spec, _, _ := strings.Cut(mapping, "@")
+    spec, _, _ = strings.Cut(spec, "/")
+    parts := strings.Split(spec, ":")
+    if len(parts) < 2 {
+        return 0, fmt.Errorf("'%s' must be [host-ip:]host-port:container-port[@node-filter]", mapping)
+    }
+    port, err := strconv.Atoi(parts[len(parts)-2])
+    if err != nil || port < 1 || port > 65535 {
+        return 0, fmt.Errorf("'%s' has an invalid host port", mapping)
+    }
+    return port, nil
+}
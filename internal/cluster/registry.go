@@ -0,0 +1,270 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cluster
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "regexp"
+    "slices"
+    "sort"
+    "strings"
+
+    "github.com/spf13/viper"
+    cfg "go-cli/internal/config"
+)
+
+// RegistryConfig describes the local registry container shared by the
+// clusters, read from the registry section of the configuration.
+type RegistryConfig struct {
+    Name  string `mapstructure:"name"`
+    Port  int    `mapstructure:"port"`
+    Image string `mapstructure:"image"`
+    // Volume is a Docker volume and HostPath a host directory keeping the
+    // images when the container is removed, at most one of them is set
+    Volume   string `mapstructure:"volume"`
+    HostPath string `mapstructure:"host_path"`
+    Restart  string `mapstructure:"restart"`
+    // Proxies are pull-through caches keyed by the upstream registry they mirror
+    Proxies map[string]ProxyConfig `mapstructure:"proxies"`
+}
+
+// ProxyConfig describes a pull-through cache registry of an upstream such as docker.io.
+type ProxyConfig struct {
+    URL      string `mapstructure:"url"`
+    Port     int    `mapstructure:"port"`
+    Username string `mapstructure:"username"`
+    // PasswordEnv names the environment variable holding the password of Username
+    PasswordEnv string `mapstructure:"password_env"`
+    Volume      string `mapstructure:"volume"`
+}
+
+// Default registry settings
+const (
+    DefaultRegistryName    = "local-registry"
+    DefaultRegistryPort    = 5000
+    DefaultRegistryImage   = "registry:2"
+    DefaultRegistryRestart = "always"
+)
+
+// knownUpstreams provides the URL and host port of the proxies of common registries
+var knownUpstreams = map[string]ProxyConfig{
+    "docker.io":       {URL: "https://registry-1.docker.io", Port: 5001},
+    "ghcr.io":         {URL: "https://ghcr.io", Port: 5002},
+    "quay.io":         {URL: "https://quay.io", Port: 5003},
+    "registry.k8s.io": {URL: "https://registry.k8s.io", Port: 5004},
+}
+
+// Port the registry listens on inside its container
+const registryContainerPort = 5000
+
+// Directory where the registry stores images inside its container
+const registryDataDir = "/var/lib/registry"
+
+// Host name k3d resolves to the Docker host inside the cluster nodes
+const dockerHost = "host.k3d.internal"
+
+var (
+    containerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+    restartPolicies      = []string{"no", "always", "unless-stopped", "on-failure"}
+)
+
+// ReadRegistryConfig reads the registry section of the configuration, applying defaults.
+func ReadRegistryConfig() (RegistryConfig, error) {
+    var config RegistryConfig
+    if err := viper.UnmarshalKey("registry", &config); err != nil {
+        return config, cfg.Invalid("registry", err)
+    }
+    if config.Name == "" {
+        config.Name = DefaultRegistryName
+    }
+    if config.Port == 0 {
+        config.Port = DefaultRegistryPort
+    }
+    if config.Image == "" {
+        config.Image = DefaultRegistryImage
+    }
+    if config.Restart == "" {
+        config.Restart = DefaultRegistryRestart
+    }
+    for upstream, proxy := range config.Proxies {
+        known := knownUpstreams[upstream]
+        if proxy.URL == "" {
+            proxy.URL = known.URL
+        }
+        if proxy.URL == "" {
+            proxy.URL = "https://" + upstream
+        }
+        if proxy.Port == 0 {
+            proxy.Port = known.Port
+        }
+        config.Proxies[upstream] = proxy
+    }
+    return config, config.validate()
+}
+
+// RegistryAddress returns the host address of the configured registry, or of
+// the default one when the configuration cannot be read.
+func RegistryAddress() string {
+    config, err := ReadRegistryConfig()
+    if err != nil {
+        return fmt.Sprintf("localhost:%d", DefaultRegistryPort)
+    }
+    return config.Address()
+}
+
+func (r RegistryConfig) validate() error {
+    if !containerNamePattern.MatchString(r.Name) {
+        return &cfg.InvalidError{Key: "registry.name", Reason: fmt.Sprintf("has invalid container name '%s'", r.Name)}
+    }
+    if r.Port < 1 || r.Port > 65535 {
+        return &cfg.InvalidError{Key: "registry.port", Reason: fmt.Sprintf("has invalid port %d", r.Port)}
+    }
+    if r.Volume != "" && r.HostPath != "" {
+        return &cfg.InvalidError{Key: "registry.host_path", Reason: "cannot be set together with registry.volume"}
+    }
+    // Paths from configuration files are already resolved against their directory
+    if r.HostPath != "" && !filepath.IsAbs(r.HostPath) {
+        return &cfg.InvalidError{Key: "registry.host_path", Reason: fmt.Sprintf("must be an absolute path, got '%s'", r.HostPath)}
+    }
+    if !slices.Contains(restartPolicies, r.Restart) {
+        return &cfg.InvalidError{Key: "registry.restart", Reason: fmt.Sprintf("has unknown policy '%s' (expected one of %v)", r.Restart, restartPolicies)}
+    }
+
+    ports := map[int]string{r.Port: "registry.port"}
+    for _, upstream := range r.Upstreams() {
+        proxy := r.Proxies[upstream]
+        key := "registry.proxies." + upstream + ".port"
+        if proxy.Port == 0 {
+            return cfg.Required(key)
+        }
+        if proxy.Port < 1 || proxy.Port > 65535 {
+            return &cfg.InvalidError{Key: key, Reason: fmt.Sprintf("has invalid port %d", proxy.Port)}
+        }
+        if proxy.Username != "" && proxy.PasswordEnv == "" {
+            return cfg.Required("registry.proxies." + upstream + ".password_env")
+        }
+        if other, ok := ports[proxy.Port]; ok {
+            return &cfg.InvalidError{Key: key, Reason: fmt.Sprintf("uses port %d already used by %s", proxy.Port, other)}
+        }
+        ports[proxy.Port] = key
+    }
+    return nil
+}
+
+// Address returns the address images are pushed to from the host.
+func (r RegistryConfig) Address() string {
+    return fmt.Sprintf("localhost:%d", r.Port)
+}
+
+// Upstreams returns the upstreams of the proxies in a stable order.
+func (r RegistryConfig) Upstreams() []string {
+    upstreams := make([]string, 0, len(r.Proxies))
+    for upstream := range r.Proxies {
+        upstreams = append(upstreams, upstream)
+    }
+    sort.Strings(upstreams)
+    return upstreams
+}
+
+// ProxyName returns the name of the container of the proxy of upstream.
+func (r RegistryConfig) ProxyName(upstream string) string {
+    return r.Name + "-proxy-" + strings.NewReplacer(".", "-", ":", "-", "/", "-").Replace(upstream)
+}
+
+// registryContainer is a registry container with the docker run arguments
+// and environment creating it.
+type registryContainer struct {
+    name string
+    args []string
+    env  []string
+}
+
+// containers returns the registry container followed by the proxy containers.
+// The password of a proxy is read from the variable its password_env names.
+func (r RegistryConfig) containers() ([]registryContainer, error) {
+    // Deletion lets 'go-cli registry rm' and 'registry gc' free space
+    args := []string{"run", "-d", "--name", r.Name, "-p", fmt.Sprintf("%d:%d", r.Port, registryContainerPort), "--restart=" + r.Restart,
+        "-e", "REGISTRY_STORAGE_DELETE_ENABLED=true"}
+    switch {
+    case r.Volume != "":
+        args = append(args, "-v", r.Volume+":"+registryDataDir)
+    case r.HostPath != "":
+        args = append(args, "-v", r.HostPath+":"+registryDataDir)
+    }
+    containers := []registryContainer{{name: r.Name, args: append(args, r.Image)}}
+
+    for _, upstream := range r.Upstreams() {
+        proxy := r.Proxies[upstream]
+        name := r.ProxyName(upstream)
+        args := []string{"run", "-d", "--name", name, "-p", fmt.Sprintf("%d:%d", proxy.Port, registryContainerPort), "--restart=" + r.Restart,
+            "-e", "REGISTRY_PROXY_REMOTEURL=" + proxy.URL}
+        // The password is passed through the environment of docker to stay out of logs
+        var env []string
+        if proxy.Username != "" {
+            password := os.Getenv(proxy.PasswordEnv)
+            if password == "" {
+                return nil, &cfg.InvalidError{Key: "registry.proxies." + upstream + ".password_env", Reason: fmt.Sprintf("names the environment variable %s, which is unset or empty", proxy.PasswordEnv)}
+            }
+            args = append(args, "-e", "REGISTRY_PROXY_USERNAME="+proxy.Username, "-e", "REGISTRY_PROXY_PASSWORD")
+            env = append(env, "REGISTRY_PROXY_PASSWORD="+password)
+        }
+        if proxy.Volume != "" {
+            args = append(args, "-v", proxy.Volume+":"+registryDataDir)
+        }
+        containers = append(containers, registryContainer{name: name, args: append(args, r.Image), env: env})
+    }
+    return containers, nil
+}
+
+// containerNames returns the names of the registry container and of its proxies.
+func (r RegistryConfig) containerNames() []string {
+    names := []string{r.Name}
+    for _, upstream := range r.Upstreams() {
+        names = append(names, r.ProxyName(upstream))
+    }
+    return names
+}
+
+// mirrors returns the k3s registries.yaml letting the nodes pull from the
+// registry, and pull the images of the proxied upstreams through their proxy.
+func (r RegistryConfig) mirrors() string {
+    var b strings.Builder
+    address := r.Address()
+    // Inside the nodes, localhost is the node itself rather than the Docker host
+    endpoint := fmt.Sprintf("http://%s:%d", dockerHost, r.Port)
+    fmt.Fprintf(&b, "mirrors:\n  %q:\n    endpoint:\n      - %q\n", address, endpoint)
+    for _, upstream := range r.Upstreams() {
+        endpoint := fmt.Sprintf("http://%s:%d", dockerHost, r.Proxies[upstream].Port)
+        fmt.Fprintf(&b, "  %q:\n    endpoint:\n      - %q\n", upstream, endpoint)
+    }
+    fmt.Fprintf(&b, `configs:
+  %q:
+    auth:
+      username: ""
+      password: ""
+    tls:
+      insecure_skip_verify: true
+`, address)
+    return b.String()
+}
@@ -0,0 +1,198 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cluster
+
+import (
+    "errors"
+    "os"
+    "reflect"
+    "strings"
+    "testing"
+
+    cfg "go-cli/internal/config"
+    "go-cli/internal/runner"
+)
+
+func TestMirrors(t *testing.T) {
+    tests := []struct {
+        name   string
+        config RegistryConfig
+        want   string
+    }{
+        {
+            name:   "registry only",
+            config: RegistryConfig{Name: "local-registry", Port: 5000},
+            want: `mirrors:
+  "localhost:5000":
+    endpoint:
+      - "http://host.k3d.internal:5000"
+configs:
+  "localhost:5000":
+    auth:
+      username: ""
+      password: ""
+    tls:
+      insecure_skip_verify: true
+`,
+        },
+        {
+            name: "custom port and proxies",
+            config: RegistryConfig{Name: "local-registry", Port: 5050, Proxies: map[string]ProxyConfig{
+                "quay.io":   {Port: 5003},
+                "docker.io": {Port: 5001},
+            }},
+            want: `mirrors:
+  "localhost:5050":
+    endpoint:
+      - "http://host.k3d.internal:5050"
+  "docker.io":
+    endpoint:
+      - "http://host.k3d.internal:5001"
+  "quay.io":
+    endpoint:
+      - "http://host.k3d.internal:5003"
+configs:
+  "localhost:5050":
+    auth:
+      username: ""
+      password: ""
+    tls:
+      insecure_skip_verify: true
+`,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := tt.config.mirrors(); got != tt.want {
+                t.Errorf("mirrors() =\n%s\nwant\n%s", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestContainers(t *testing.T) {
+    t.Setenv("GHCR_TOKEN", "s3cret")
+    config := RegistryConfig{
+        Name:    "local-registry",
+        Port:    5000,
+        Image:   "registry:2",
+        Volume:  "registry-data",
+        Restart: "always",
+        Proxies: map[string]ProxyConfig{
+            "docker.io": {URL: "https://registry-1.docker.io", Port: 5001, Volume: "docker-cache"},
+            "ghcr.io":   {URL: "https://ghcr.io", Port: 5002, Username: "me", PasswordEnv: "GHCR_TOKEN"},
+        },
+    }
+
+    tests := []struct {
+        name     string
+        wantArgs []string
+        wantEnv  []string
+    }{
+        {
+            name: "local-registry",
+            wantArgs: []string{"run", "-d", "--name", "local-registry", "-p", "5000:5000", "--restart=always",
+                "-e", "REGISTRY_STORAGE_DELETE_ENABLED=true", "-v", "registry-data:/var/lib/registry", "registry:2"},
+        },
+        {
+            name: "local-registry-proxy-docker-io",
+            wantArgs: []string{"run", "-d", "--name", "local-registry-proxy-docker-io", "-p", "5001:5000", "--restart=always",
+                "-e", "REGISTRY_PROXY_REMOTEURL=https://registry-1.docker.io", "-v", "docker-cache:/var/lib/registry", "registry:2"},
+        },
+        {
+            name: "local-registry-proxy-ghcr-io",
+            wantArgs: []string{"run", "-d", "--name", "local-registry-proxy-ghcr-io", "-p", "5002:5000", "--restart=always",
+                "-e", "REGISTRY_PROXY_REMOTEURL=https://ghcr.io", "-e", "REGISTRY_PROXY_USERNAME=me", "-e", "REGISTRY_PROXY_PASSWORD", "registry:2"},
+            wantEnv: []string{"REGISTRY_PROXY_PASSWORD=s3cret"},
+        },
+    }
+
+    containers, err := config.containers()
+    if err != nil {
+        t.Fatalf("containers() error = %v", err)
+    }
+    if len(containers) != len(tests) {
+        t.Fatalf("containers() returned %d containers, want %d", len(containers), len(tests))
+    }
+    for i, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            container := containers[i]
+            if container.name != tt.name {
+                t.Errorf("name = %s, want %s", container.name, tt.name)
+            }
+            if !reflect.DeepEqual(container.args, tt.wantArgs) {
+                t.Errorf("args = %q, want %q", container.args, tt.wantArgs)
+            }
+            if !reflect.DeepEqual(container.env, tt.wantEnv) {
+                t.Errorf("env = %q, want %q", container.env, tt.wantEnv)
+            }
+            // The password only travels through the environment of docker
+            if strings.Contains(strings.Join(container.args, " "), "s3cret") {
+                t.Errorf("args %q contain the proxy password", container.args)
+            }
+        })
+    }
+}
+
+func TestContainersWithoutPassword(t *testing.T) {
+    config := RegistryConfig{Name: "local-registry", Port: 5000, Image: "registry:2", Restart: "always", Proxies: map[string]ProxyConfig{
+        "ghcr.io": {URL: "https://ghcr.io", Port: 5002, Username: "me", PasswordEnv: "GHCR_TOKEN"},
+    }}
+
+    for _, unset := range []bool{false, true} {
+        t.Setenv("GHCR_TOKEN", "")
+        if unset {
+            os.Unsetenv("GHCR_TOKEN")
+        }
+
+        _, err := config.containers()
+        var invalid *cfg.InvalidError
+        if !errors.As(err, &invalid) || invalid.Key != "registry.proxies.ghcr.io.password_env" || !strings.Contains(err.Error(), "GHCR_TOKEN") {
+            t.Errorf("containers() with GHCR_TOKEN unset=%v error = %v, want an invalid password_env naming GHCR_TOKEN", unset, err)
+        }
+    }
+}
+
+func TestEnsureRegistryRunningKeepsPasswordOutOfCommandLine(t *testing.T) {
+    t.Setenv("GHCR_TOKEN", "s3cret")
+    recorder := &runner.Recorder{}
+    SetRunner(recorder)
+    t.Cleanup(func() { SetRunner(runner.Exec{}) })
+
+    config := RegistryConfig{Name: "local-registry", Port: 5000, Image: "registry:2", Restart: "always", Proxies: map[string]ProxyConfig{
+        "ghcr.io": {URL: "https://ghcr.io", Port: 5002, Username: "me", PasswordEnv: "GHCR_TOKEN"},
+    }}
+    if err := ensureRegistryRunning(config, false); err != nil {
+        t.Fatal(err)
+    }
+
+    calls := recorder.Calls()
+    proxy := calls[len(calls)-1]
+    if want := []string{"REGISTRY_PROXY_PASSWORD=s3cret"}; !reflect.DeepEqual(proxy.Env, want) {
+        t.Errorf("env = %q, want %q", proxy.Env, want)
+    }
+    for _, line := range recorder.Lines() {
+        if strings.Contains(line, "s3cret") {
+            t.Errorf("command line %q contains the proxy password", line)
+        }
+    }
+}
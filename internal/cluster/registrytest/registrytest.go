@@ -0,0 +1,316 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+// Package registrytest provides an in-memory stand-in for a Docker registry,
+// serving the parts of the registry HTTP API used by go-cli, so code talking
+// to the local registry or its pull-through proxies can run without Docker.
+package registrytest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ManifestType is the media type of the manifests served by the stand-in
+const ManifestType = "application/vnd.docker.distribution.manifest.v2+json"
+
+// Server is a registry serving images pushed with Push. When Upstream is set,
+// it acts as a pull-through cache of it: manifests it does not have are
+// fetched from the upstream and kept.
+type Server struct {
+	*httptest.Server
+
+	// Upstream is the registry proxied by the server, nil for a plain registry
+	Upstream *Server
+	// DeleteDisabled makes manifest deletion fail as on a registry without
+	// REGISTRY_STORAGE_DELETE_ENABLED
+	DeleteDisabled bool
+
+	mu    sync.Mutex
+	repos map[string]map[string]string
+	blobs map[string][]byte
+	pulls int
+}
+
+// NewServer starts a registry, close it with Close.
+func NewServer() *Server {
+	s := &Server{repos: make(map[string]map[string]string), blobs: make(map[string][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// NewProxy starts a pull-through cache of upstream.
+func NewProxy(upstream *Server) *Server {
+	s := NewServer()
+	s.Upstream = upstream
+	return s
+}
+
+// Host returns the host:port of the server, as used in image references.
+func (s *Server) Host() string {
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+// Push stores an image created at created under repository:tag and returns
+// the digest of its manifest.
+func (s *Server) Push(repository string, tag string, created time.Time) string {
+	config, _ := json.Marshal(map[string]string{"created": created.UTC().Format(time.RFC3339Nano), "os": "linux", "architecture": "amd64"})
+	configDigest := digest(config)
+	manifest, _ := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     ManifestType,
+		"config": map[string]any{
+			"mediaType": "application/vnd.docker.container.image.v1+json",
+			"size":      len(config),
+			"digest":    configDigest,
+		},
+		"layers": []any{},
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	manifestDigest := digest(manifest)
+	s.blobs[configDigest] = config
+	s.blobs[manifestDigest] = manifest
+	s.tag(repository, tag, manifestDigest)
+	return manifestDigest
+}
+
+func (s *Server) tag(repository string, tag string, manifestDigest string) {
+	if s.repos[repository] == nil {
+		s.repos[repository] = make(map[string]string)
+	}
+	s.repos[repository][tag] = manifestDigest
+}
+
+// Tags returns the tags of repository, sorted.
+func (s *Server) Tags(repository string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tags []string
+	for tag := range s.repos[repository] {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Pulls returns the number of manifests served by the server.
+func (s *Server) Pulls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pulls
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	switch {
+	case r.URL.Path == "/v2/" || r.URL.Path == "/v2":
+		writeJSON(w, http.StatusOK, map[string]any{})
+	case path == "_catalog":
+		s.catalog(w)
+	case strings.HasSuffix(path, "/tags/list"):
+		s.tags(w, strings.TrimSuffix(path, "/tags/list"))
+	case strings.Contains(path, "/manifests/"):
+		name, reference, _ := cut(path, "/manifests/")
+		s.manifest(w, r, name, reference)
+	case strings.Contains(path, "/blobs/"):
+		_, blobDigest, _ := cut(path, "/blobs/")
+		s.blob(w, blobDigest)
+	default:
+		writeError(w, http.StatusNotFound, "UNSUPPORTED", "unsupported endpoint")
+	}
+}
+
+// cut splits path at the last occurrence of sep, repository names containing slashes.
+func cut(path string, sep string) (string, string, bool) {
+	i := strings.LastIndex(path, sep)
+	if i < 0 {
+		return path, "", false
+	}
+	return path[:i], path[i+len(sep):], true
+}
+
+func (s *Server) catalog(w http.ResponseWriter) {
+	s.mu.Lock()
+	repositories := []string{}
+	for repository, tags := range s.repos {
+		if len(tags) > 0 {
+			repositories = append(repositories, repository)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Strings(repositories)
+	writeJSON(w, http.StatusOK, map[string]any{"repositories": repositories})
+}
+
+func (s *Server) tags(w http.ResponseWriter, name string) {
+	tags := s.Tags(name)
+	if tags == nil {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"name": name, "tags": tags})
+}
+
+func (s *Server) manifest(w http.ResponseWriter, r *http.Request, name string, reference string) {
+	if r.Method == http.MethodDelete {
+		s.deleteManifest(w, name, reference)
+		return
+	}
+
+	manifestDigest, manifest, ok := s.lookup(name, reference)
+	if !ok && s.Upstream != nil {
+		manifestDigest, manifest, ok = s.pullThrough(name, reference)
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+		return
+	}
+
+	s.mu.Lock()
+	s.pulls++
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", ManifestType)
+	w.Header().Set("Docker-Content-Digest", manifestDigest)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Write(manifest)
+}
+
+func (s *Server) lookup(name string, reference string) (string, []byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	manifestDigest := reference
+	if !strings.HasPrefix(reference, "sha256:") {
+		manifestDigest = s.repos[name][reference]
+	} else if !s.references(name, reference) {
+		return "", nil, false
+	}
+	manifest, ok := s.blobs[manifestDigest]
+	return manifestDigest, manifest, ok
+}
+
+// references reports whether a tag of repository name points at manifestDigest.
+func (s *Server) references(name string, manifestDigest string) bool {
+	for _, d := range s.repos[name] {
+		if d == manifestDigest {
+			return true
+		}
+	}
+	return false
+}
+
+// pullThrough copies an image from the upstream and keeps it.
+func (s *Server) pullThrough(name string, reference string) (string, []byte, bool) {
+	manifestDigest, manifest, ok := s.Upstream.lookup(name, reference)
+	if !ok {
+		return "", nil, false
+	}
+
+	s.Upstream.mu.Lock()
+	s.Upstream.pulls++
+	var configDigest struct {
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+	}
+	json.Unmarshal(manifest, &configDigest)
+	config := s.Upstream.blobs[configDigest.Config.Digest]
+	s.Upstream.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[manifestDigest] = manifest
+	s.blobs[configDigest.Config.Digest] = config
+	tag := reference
+	if strings.HasPrefix(reference, "sha256:") {
+		tag = strings.TrimPrefix(reference, "sha256:")[:12]
+	}
+	s.tag(name, tag, manifestDigest)
+	return manifestDigest, manifest, true
+}
+
+func (s *Server) deleteManifest(w http.ResponseWriter, name string, reference string) {
+	if s.DeleteDisabled {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "The operation is unsupported.")
+		return
+	}
+	if !strings.HasPrefix(reference, "sha256:") {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "manifests are deleted by digest")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.references(name, reference) {
+		writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+		return
+	}
+	// Deleting a manifest removes every tag pointing at it
+	for tag, d := range s.repos[name] {
+		if d == reference {
+			delete(s.repos[name], tag)
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) blob(w http.ResponseWriter, blobDigest string) {
+	s.mu.Lock()
+	blob, ok := s.blobs[blobDigest]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+		return
+	}
+	w.Header().Set("Docker-Content-Digest", blobDigest)
+	w.Write(blob)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, map[string]any{"errors": []map[string]string{{"code": code, "message": message}}})
+}
@@ -0,0 +1,90 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package registrytest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go-cli/internal/registry"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestProxyPullsThrough(t *testing.T) {
+	upstream := NewServer()
+	defer upstream.Close()
+	proxy := NewProxy(upstream)
+	defer proxy.Close()
+
+	digest := upstream.Push("library/alpine", "3.19", epoch)
+	client := registry.NewClient(proxy.Host())
+
+	tests := []struct {
+		name          string
+		reference     string
+		wantUpstream  int
+		wantProxyTags []string
+	}{
+		{name: "first pull fetches the upstream", reference: "3.19", wantUpstream: 1, wantProxyTags: []string{"3.19"}},
+		{name: "second pull is cached", reference: "3.19", wantUpstream: 1, wantProxyTags: []string{"3.19"}},
+		{name: "pull by digest is cached", reference: digest, wantUpstream: 1, wantProxyTags: []string{"3.19"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image, err := client.Inspect("library/alpine", tt.reference)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if image.Digest != digest {
+				t.Errorf("Inspect().Digest = %s, want %s", image.Digest, digest)
+			}
+			if !image.Created.Equal(epoch) {
+				t.Errorf("Inspect().Created = %v, want %v", image.Created, epoch)
+			}
+			if got := upstream.Pulls(); got != tt.wantUpstream {
+				t.Errorf("upstream served %d manifests, want %d", got, tt.wantUpstream)
+			}
+			if got := proxy.Tags("library/alpine"); !reflect.DeepEqual(got, tt.wantProxyTags) {
+				t.Errorf("proxy tags = %v, want %v", got, tt.wantProxyTags)
+			}
+		})
+	}
+}
+
+func TestProxyUnknownImage(t *testing.T) {
+	upstream := NewServer()
+	defer upstream.Close()
+	proxy := NewProxy(upstream)
+	defer proxy.Close()
+
+	_, err := registry.NewClient(proxy.Host()).Inspect("library/alpine", "missing")
+	var apiErr *registry.APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != 404 || apiErr.Code != "MANIFEST_UNKNOWN" {
+		t.Errorf("Inspect() error = %v, want a 404 MANIFEST_UNKNOWN", err)
+	}
+	if got := proxy.Tags("library/alpine"); got != nil {
+		t.Errorf("proxy tags = %v, want none", got)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cluster
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+    "time"
+
+    "go-cli/internal/kube"
+    "go-cli/internal/runner"
+)
+
+// Status describes the state of a cluster, of the registry and of the kubeconfig context.
+type Status struct {
+    Name     string
+    Exists   bool
+    Nodes    []NodeStatus
+    Registry RegistryConfig
+    // RegistryState is the state of the registry container, empty when it does not exist
+    RegistryState   string
+    RegistryHealthy bool
+    // Context is the current kubeconfig context, empty when none is set
+    Context string
+}
+
+// NodeStatus reports whether a node container runs and whether Kubernetes
+// considers it ready. Ready is nil when readiness is unknown.
+type NodeStatus struct {
+    Name    string
+    Role    string
+    Running bool
+    Ready   *bool
+}
+
+// GetStatus inspects the cluster, the registry and the kubeconfig context.
+func GetStatus(config Config) (Status, error) {
+    status := Status{Name: config.Name, Registry: config.Registry}
+
+    info, err := Get(config.Name)
+    if err != nil {
+        return status, err
+    }
+    status.Exists = info != nil
+
+    if info != nil {
+        ready := nodeReadiness(config.Name)
+        for _, node := range info.Nodes {
+            // The load balancer and tools containers are not Kubernetes nodes
+            if node.Role != "server" && node.Role != "agent" {
+                continue
+            }
+            nodeStatus := NodeStatus{Name: node.Name, Role: node.Role, Running: node.State.Running}
+            if r, ok := ready[node.Name]; ok {
+                nodeStatus.Ready = &r
+            }
+            status.Nodes = append(status.Nodes, nodeStatus)
+        }
+    }
+
+    output, _ := cmdRunner.Output(runner.Command(false, "docker", "inspect", "--format", "{{.State.Status}}", config.Registry.Name))
+    status.RegistryState = strings.TrimSpace(string(output))
+    if status.RegistryState == "running" {
+        status.RegistryHealthy = registryHealthy(config.Registry)
+    }
+
+    status.Context, _ = kube.CurrentContext()
+
+    return status, nil
+}
+
+// nodeReadiness returns the Ready condition of the nodes of the cluster, or
+// nil when kubectl cannot reach it.
+func nodeReadiness(name string) map[string]bool {
+    output, err := cmdRunner.Output(runner.Command(false, "kubectl", "--context", KubeContext(name), "get", "nodes", "-o", "json", "--request-timeout", "5s"))
+    if err != nil || len(output) == 0 {
+        return nil
+    }
+
+    var nodes struct {
+        Items []struct {
+            Metadata struct {
+                Name string `json:"name"`
+            } `json:"metadata"`
+            Status struct {
+                Conditions []struct {
+                    Type   string `json:"type"`
+                    Status string `json:"status"`
+                } `json:"conditions"`
+            } `json:"status"`
+        } `json:"items"`
+    }
+    if err := json.Unmarshal(output, &nodes); err != nil {
+        return nil
+    }
+
+    ready := make(map[string]bool)
+    for _, item := range nodes.Items {
+        ready[item.Metadata.Name] = false
+        for _, condition := range item.Status.Conditions {
+            if condition.Type == "Ready" {
+                ready[item.Metadata.Name] = condition.Status == "True"
+            }
+        }
+    }
+    return ready
+}
+
+// registryHealthy reports whether the registry answers its API endpoint.
+func registryHealthy(registry RegistryConfig) bool {
+    client := http.Client{Timeout: 2 * time.Second}
+    resp, err := client.Get("http://" + registry.Address() + "/v2/")
+    if err != nil {
+        return false
+    }
+    resp.Body.Close()
+    return resp.StatusCode == http.StatusOK
+}
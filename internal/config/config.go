@@ -0,0 +1,110 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NotFoundError reports an application or dependency missing from the configuration.
+type NotFoundError struct {
+	Kind string
+	Name string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("no configuration found for %s '%s'", e.Kind, e.Name)
+}
+
+// InvalidError reports a configuration value that is missing or unusable.
+type InvalidError struct {
+	Key    string
+	Reason string
+	Err    error
+}
+
+func (e *InvalidError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s %s: %v", e.Key, e.Reason, e.Err)
+	}
+	return fmt.Sprintf("%s %s", e.Key, e.Reason)
+}
+
+func (e *InvalidError) Unwrap() error {
+	return e.Err
+}
+
+// Required reports a missing required configuration value.
+func Required(key string) error {
+	return &InvalidError{Key: key, Reason: "is required"}
+}
+
+// Invalid reports a configuration value that cannot be used.
+func Invalid(key string, err error) error {
+	return &InvalidError{Key: key, Reason: "is invalid", Err: err}
+}
+
+// FileError reports a configuration file that cannot be read or parsed.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("error reading config file '%s': %v", e.Path, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Problem is a mistake found in the configuration, at Key when it has one.
+type Problem struct {
+	Key      string
+	Message  string
+	Position Position
+}
+
+func (p Problem) String() string {
+	msg := p.Message
+	if p.Key != "" {
+		msg = p.Key + " " + msg
+	}
+	if p.Position.File != "" {
+		msg = p.Position.String() + ": " + msg
+	}
+	return msg
+}
+
+// ValidationError lists the problems found in the configuration.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		lines[i] = problem.String()
+	}
+	return fmt.Sprintf("configuration has %d problem(s):\n  %s", len(e.Problems), strings.Join(lines, "\n  "))
+}
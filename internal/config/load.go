@@ -0,0 +1,386 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// ProfileEnv selects a profile when --profile is not given
+const ProfileEnv = "GO_CLI_PROFILE"
+
+// ProjectFile is the name of the configuration files discovered from the
+// working directory up
+const ProjectFile = ".go-cli.yaml"
+
+// document is the configuration as written, with the files merged and the
+// profile applied. positions locate its keys, lowercased, in the files.
+var (
+	document  map[string]any
+	positions map[string]Position
+	files     []string
+	profile   string
+)
+
+// Position locates a key in a configuration file.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Load merges the configuration file found by viper with the project files
+// found from the working directory up, deep-merges the section of profiles
+// named profileName on top of them, and hands the result to viper.
+func Load(profileName string) error {
+	profile = profileName
+	return Reload()
+}
+
+// Reload loads the configuration again with the profile given to Load.
+func Reload() error {
+	document = nil
+	positions = map[string]Position{}
+
+	var err error
+	if files, err = configFiles(); err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		if profile != "" {
+			return &InvalidError{Key: "profiles", Reason: fmt.Sprintf("has no '%s' profile, no configuration file was found", profile)}
+		}
+		return nil
+	}
+
+	doc := map[string]any{}
+	for _, path := range files {
+		fileDoc, err := readFile(path)
+		if err != nil {
+			return err
+		}
+		resolvePaths(fileDoc, filepath.Dir(path))
+		doc = merge(doc, fileDoc)
+	}
+
+	if profile != "" {
+		overrides, err := profileOverrides(doc, profile)
+		if err != nil {
+			return err
+		}
+		doc = merge(doc, overrides)
+
+		// Overridden keys are declared by the profile
+		prefix := "profiles." + strings.ToLower(profile) + "."
+		for key, position := range positions {
+			if strings.HasPrefix(key, prefix) {
+				positions[strings.TrimPrefix(key, prefix)] = position
+			}
+		}
+	}
+
+	resolveInstallPaths(doc)
+
+	// Every file was parsed as YAML, whatever its extension
+	merged, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(bytes.NewReader(merged)); err != nil {
+		return err
+	}
+	document = doc
+	return nil
+}
+
+// Files returns the configuration files in use, the ones taking precedence last.
+func Files() []string {
+	return files
+}
+
+// Document returns the loaded configuration as written, nil when there is none.
+func Document() map[string]any {
+	return document
+}
+
+// PositionOf returns where key, or its closest parent, is declared.
+func PositionOf(key string) (Position, bool) {
+	key = strings.ToLower(key)
+	for {
+		if position, ok := positions[key]; ok {
+			return position, true
+		}
+		i := strings.LastIndex(key, ".")
+		if i < 0 {
+			return Position{}, false
+		}
+		key = key[:i]
+	}
+}
+
+// configFiles returns the configuration file found by viper followed by the
+// project files from the outermost directory to the working directory.
+func configFiles() ([]string, error) {
+	var paths []string
+	if path := viper.ConfigFileUsed(); path != "" {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, &FileError{Path: path, Err: err}
+		}
+		paths = append(paths, abs)
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	var project []string
+	for {
+		path := filepath.Join(dir, ProjectFile)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() && (len(paths) == 0 || path != paths[0]) {
+			project = append([]string{path}, project...)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return append(paths, project...), nil
+}
+
+func readFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &FileError{Path: path, Err: err}
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, &FileError{Path: path, Err: err}
+	}
+	doc := map[string]any{}
+	if len(node.Content) == 0 {
+		return doc, nil
+	}
+	if err := node.Decode(&doc); err != nil {
+		return nil, &FileError{Path: path, Err: err}
+	}
+	recordPositions(&node, "", path)
+	return doc, nil
+}
+
+// recordPositions records the position of the keys and list items below
+// node, key being the path of node.
+func recordPositions(node *yaml.Node, key string, path string) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			recordPositions(child, key, path)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			child := strings.ToLower(k.Value)
+			if key != "" {
+				child = key + "." + child
+			}
+			positions[child] = Position{File: path, Line: k.Line, Column: k.Column}
+			recordPositions(v, child, path)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			child := fmt.Sprintf("%s.%d", key, i)
+			positions[child] = Position{File: path, Line: item.Line, Column: item.Column}
+			recordPositions(item, child, path)
+		}
+	}
+}
+
+// resolvePaths makes the relative paths of a configuration file absolute
+// against dir, its directory, so they keep pointing next to it once merged.
+// The chart_path and values files of apps are left to resolveInstallPaths,
+// as whether they are relative to a project is only known once merged.
+func resolvePaths(doc map[string]any, dir string) {
+	apps, _ := lookup(doc, "apps").(map[string]any)
+	for _, app := range apps {
+		if app, ok := app.(map[string]any); ok {
+			resolvePath(app, "project_path", dir)
+		}
+	}
+
+	dependencies, _ := lookup(doc, "dependencies").(map[string]any)
+	for _, dependency := range dependencies {
+		if dependency, ok := dependency.(map[string]any); ok {
+			resolvePath(dependency, "values_file", dir)
+			resolvePath(dependency, "values_files", dir)
+		}
+	}
+
+	if registry, ok := lookup(doc, "registry").(map[string]any); ok {
+		resolvePath(registry, "host_path", dir)
+	}
+
+	profiles, _ := lookup(doc, "profiles").(map[string]any)
+	for _, overrides := range profiles {
+		if overrides, ok := overrides.(map[string]any); ok {
+			resolvePaths(overrides, dir)
+		}
+	}
+}
+
+// resolveInstallPaths makes the chart_path and values files of the apps
+// without a project_path absolute against the directory of the file declaring
+// them. Those of the other apps stay relative to their project.
+func resolveInstallPaths(doc map[string]any) {
+	apps, _ := lookup(doc, "apps").(map[string]any)
+	for name, app := range apps {
+		app, ok := app.(map[string]any)
+		if !ok {
+			continue
+		}
+		if projectPath, _ := lookup(app, "project_path").(string); projectPath != "" {
+			continue
+		}
+		install, ok := lookup(app, "install").(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, key := range []string{"chart_path", "values_file", "values_files"} {
+			if position, ok := positions["apps."+strings.ToLower(name)+".install."+key]; ok {
+				resolvePath(install, key, filepath.Dir(position.File))
+			}
+		}
+	}
+}
+
+// resolvePath resolves the path, or list of paths, at key of m against dir
+// and reports whether key is set.
+func resolvePath(m map[string]any, key string, dir string) bool {
+	for k, v := range m {
+		if !strings.EqualFold(k, key) {
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			m[k] = absPath(v, dir)
+		case []any:
+			for i, item := range v {
+				if item, ok := item.(string); ok {
+					v[i] = absPath(item, dir)
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func absPath(path string, dir string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// Profile returns the name of the applied profile, empty when none is.
+func Profile() string {
+	return profile
+}
+
+func profileOverrides(doc map[string]any, name string) (map[string]any, error) {
+	profiles, _ := lookup(doc, "profiles").(map[string]any)
+	// Profile names match case-insensitively like the keys they override
+	value, ok := profiles[name]
+	if !ok {
+		for k, v := range profiles {
+			if strings.EqualFold(k, name) {
+				name, value, ok = k, v, true
+				break
+			}
+		}
+	}
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		available := "none defined"
+		if len(names) > 0 {
+			available = "available: " + strings.Join(names, ", ")
+		}
+		return nil, &InvalidError{Key: "profiles", Reason: fmt.Sprintf("has no '%s' profile (%s)", name, available)}
+	}
+	if value == nil {
+		return nil, nil
+	}
+	overrides, ok := value.(map[string]any)
+	if !ok {
+		return nil, &InvalidError{Key: "profiles." + name, Reason: "must be a map of configuration overrides"}
+	}
+	return overrides, nil
+}
+
+// merge returns base with overrides applied: maps are merged recursively,
+// other values replace the base ones and null values remove them. Keys
+// match case-insensitively like viper's.
+func merge(base map[string]any, overrides map[string]any) map[string]any {
+	merged := make(map[string]any, len(base))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		key := k
+		for existing := range merged {
+			if strings.EqualFold(existing, k) {
+				key = existing
+				break
+			}
+		}
+
+		baseMap, baseIsMap := merged[key].(map[string]any)
+		overrideMap, overrideIsMap := v.(map[string]any)
+		switch {
+		case v == nil:
+			delete(merged, key)
+		case baseIsMap && overrideIsMap:
+			merged[key] = merge(baseMap, overrideMap)
+		default:
+			delete(merged, key)
+			merged[k] = v
+		}
+	}
+	return merged
+}
@@ -0,0 +1,193 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// writeFile writes content to path, creating its directory.
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// load loads the configuration file at path, when set, from the directory
+// dir with the profile named profileName.
+func load(t *testing.T, path string, dir string, profileName string) error {
+	t.Helper()
+	t.Chdir(dir)
+	viper.Reset()
+	if path != "" {
+		viper.SetConfigFile(path)
+	}
+	t.Cleanup(func() {
+		viper.Reset()
+		profile = ""
+		document, positions, files = nil, nil, nil
+	})
+	return Load(profileName)
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      map[string]any
+		overrides map[string]any
+		want      map[string]any
+	}{
+		{
+			name:      "maps are merged recursively",
+			base:      map[string]any{"cluster": map[string]any{"name": "local", "agents": 1}},
+			overrides: map[string]any{"cluster": map[string]any{"agents": 3}},
+			want:      map[string]any{"cluster": map[string]any{"name": "local", "agents": 3}},
+		},
+		{
+			name:      "lists are replaced",
+			base:      map[string]any{"ports": []any{"8080:80"}},
+			overrides: map[string]any{"ports": []any{"9090:80"}},
+			want:      map[string]any{"ports": []any{"9090:80"}},
+		},
+		{
+			name:      "null removes a key",
+			base:      map[string]any{"registry": map[string]any{"port": 5050, "volume": "data"}},
+			overrides: map[string]any{"registry": map[string]any{"volume": nil}},
+			want:      map[string]any{"registry": map[string]any{"port": 5050}},
+		},
+		{
+			name:      "keys match case-insensitively",
+			base:      map[string]any{"apps": map[string]any{"API": map[string]any{"namespace": "app"}}},
+			overrides: map[string]any{"apps": map[string]any{"api": map[string]any{"depends_on": []any{"redis"}}}},
+			want:      map[string]any{"apps": map[string]any{"API": map[string]any{"namespace": "app", "depends_on": []any{"redis"}}}},
+		},
+		{
+			name:      "a scalar replaces a map",
+			base:      map[string]any{"values": map[string]any{"replicas": 1}},
+			overrides: map[string]any{"values": "none"},
+			want:      map[string]any{"values": "none"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := merge(tt.base, tt.overrides); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("merge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeFile(t, path, `cluster:
+  name: local
+  agents: 1
+apps:
+  api:
+    install:
+      values:
+        podAnnotations:
+          Team: core
+profiles:
+  CI:
+    cluster:
+      agents: 0
+      disable: [traefik]
+    apps:
+      api:
+        install:
+          values:
+            podAnnotations:
+              Build: "42"
+  empty:
+`)
+
+	tests := []struct {
+		profile    string
+		wantAgents int
+		wantValues map[string]any
+		wantLine   int
+	}{
+		{profile: "", wantAgents: 1, wantValues: map[string]any{"Team": "core"}, wantLine: 3},
+		// Profile names match whatever their case
+		{profile: "ci", wantAgents: 0, wantValues: map[string]any{"Team": "core", "Build": "42"}, wantLine: 13},
+		{profile: "EMPTY", wantAgents: 1, wantValues: map[string]any{"Team": "core"}, wantLine: 3},
+		{profile: "empty", wantAgents: 1, wantValues: map[string]any{"Team": "core"}, wantLine: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			if err := load(t, path, dir, tt.profile); err != nil {
+				t.Fatal(err)
+			}
+			if got := viper.GetInt("cluster.agents"); got != tt.wantAgents {
+				t.Errorf("cluster.agents = %d, want %d", got, tt.wantAgents)
+			}
+			if got := viper.GetString("cluster.name"); got != "local" {
+				t.Errorf("cluster.name = %s, want local", got)
+			}
+			// Raw keeps the case viper loses
+			if got, _ := RawMap("apps.api.install.values.podAnnotations"); !reflect.DeepEqual(got, tt.wantValues) {
+				t.Errorf("podAnnotations = %v, want %v", got, tt.wantValues)
+			}
+			if position, _ := PositionOf("cluster.agents"); position.Line != tt.wantLine || position.File != path {
+				t.Errorf("PositionOf(cluster.agents) = %s, want line %d of %s", position, tt.wantLine, path)
+			}
+			if Profile() != tt.profile {
+				t.Errorf("Profile() = %s, want %s", Profile(), tt.profile)
+			}
+		})
+	}
+}
+
+func TestLoadUnknownProfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeFile(t, path, "profiles:\n  ci:\n    cluster:\n      agents: 0\n  dev:\n")
+
+	err := load(t, path, dir, "prod")
+	var invalid *InvalidError
+	if !errors.As(err, &invalid) || invalid.Key != "profiles" {
+		t.Fatalf("Load(prod) error = %v, want an invalid profiles", err)
+	}
+	if want := "has no 'prod' profile (available: ci, dev)"; invalid.Reason != want {
+		t.Errorf("reason = %q, want %q", invalid.Reason, want)
+	}
+}
+
+func TestLoadProfileWithoutFile(t *testing.T) {
+	err := load(t, "", t.TempDir(), "ci")
+	var invalid *InvalidError
+	if !errors.As(err, &invalid) || invalid.Key != "profiles" {
+		t.Fatalf("Load(ci) error = %v, want an invalid profiles", err)
+	}
+}
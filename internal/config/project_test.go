@@ -0,0 +1,158 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// projectTree writes a configuration file in root and project files in root
+// and root/service, and returns root.
+func projectTree(t *testing.T, config string, outer string, inner string) string {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, "config", "config.yaml"), config)
+	if outer != "" {
+		writeFile(t, filepath.Join(root, ProjectFile), outer)
+	}
+	if inner != "" {
+		writeFile(t, filepath.Join(root, "service", ProjectFile), inner)
+	}
+	return root
+}
+
+func TestFiles(t *testing.T) {
+	root := projectTree(t,
+		"cluster:\n  name: config\n  agents: 1\n  servers: 1\n",
+		"cluster:\n  name: outer\n  agents: 2\n",
+		"cluster:\n  name: inner\n",
+	)
+	config := filepath.Join(root, "config", "config.yaml")
+	if err := load(t, config, filepath.Join(root, "service"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{config, filepath.Join(root, ProjectFile), filepath.Join(root, "service", ProjectFile)}
+	if got := Files(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Files() = %v, want %v", got, want)
+	}
+	// The files closest to the working directory take precedence
+	if got := viper.GetString("cluster.name"); got != "inner" {
+		t.Errorf("cluster.name = %s, want inner", got)
+	}
+	if got := viper.GetInt("cluster.agents"); got != 2 {
+		t.Errorf("cluster.agents = %d, want 2", got)
+	}
+	if got := viper.GetInt("cluster.servers"); got != 1 {
+		t.Errorf("cluster.servers = %d, want 1", got)
+	}
+	if position, _ := PositionOf("cluster.name"); position.File != want[2] {
+		t.Errorf("PositionOf(cluster.name) = %s, want in %s", position, want[2])
+	}
+}
+
+func TestFilesWithoutConfigFile(t *testing.T) {
+	root := projectTree(t, "", "cluster:\n  name: outer\n", "")
+	if err := load(t, "", root, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Files(), []string{filepath.Join(root, ProjectFile)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Files() = %v, want %v", got, want)
+	}
+}
+
+func TestResolvePaths(t *testing.T) {
+	root := projectTree(t,
+		`registry:
+  host_path: data/registry
+dependencies:
+  redis:
+    values_file: values/redis.yaml
+    values_files: [values/a.yaml, /etc/b.yaml]
+`,
+		`apps:
+  api:
+    project_path: api
+  web:
+    install:
+      chart_path: charts/web
+      values_files: [values/web.yaml]
+`,
+		`apps:
+  worker:
+    project_path: .
+    install:
+      chart_path: chart
+      values_file: values.yaml
+  api:
+    install:
+      chart_path: chart
+profiles:
+  ci:
+    apps:
+      web:
+        project_path: web
+`,
+	)
+	config := filepath.Join(root, "config")
+	service := filepath.Join(root, "service")
+
+	tests := []struct {
+		profile string
+		key     string
+		want    any
+	}{
+		{key: "registry.host_path", want: filepath.Join(config, "data/registry")},
+		{key: "dependencies.redis.values_file", want: filepath.Join(config, "values/redis.yaml")},
+		{key: "dependencies.redis.values_files", want: []any{filepath.Join(config, "values/a.yaml"), "/etc/b.yaml"}},
+		{key: "apps.api.project_path", want: filepath.Join(root, "api")},
+		{key: "apps.worker.project_path", want: service},
+		// Install paths stay relative to the project_path, whichever file sets it
+		{key: "apps.worker.install.chart_path", want: "chart"},
+		{key: "apps.worker.install.values_file", want: "values.yaml"},
+		{key: "apps.api.install.chart_path", want: "chart"},
+		// and are resolved against the file declaring them without one
+		{key: "apps.web.install.chart_path", want: filepath.Join(root, "charts/web")},
+		{key: "apps.web.install.values_files", want: []any{filepath.Join(root, "values/web.yaml")}},
+		// unless the profile sets a project_path
+		{profile: "ci", key: "apps.web.project_path", want: filepath.Join(service, "web")},
+		{profile: "ci", key: "apps.web.install.chart_path", want: "charts/web"},
+		{profile: "ci", key: "apps.web.install.values_files", want: []any{"values/web.yaml"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.profile+"/"+tt.key, func(t *testing.T) {
+			if err := load(t, filepath.Join(config, "config.yaml"), service, tt.profile); err != nil {
+				t.Fatal(err)
+			}
+			if got := Raw(tt.key); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
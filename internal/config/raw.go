@@ -0,0 +1,67 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Raw returns the value at key as written in the configuration, nil when it
+// is not set. Unlike viper it keeps the case of map keys, which matters for
+// Helm values. Segments of key match case-insensitively.
+func Raw(key string) any {
+	if document == nil {
+		return nil
+	}
+	var value any = document
+	for _, segment := range strings.Split(key, ".") {
+		value = lookup(value, segment)
+	}
+	return value
+}
+
+func lookup(value any, segment string) any {
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, segment) {
+			return v
+		}
+	}
+	return nil
+}
+
+// RawMap is Raw for keys holding a map.
+func RawMap(key string) (map[string]any, error) {
+	value := Raw(key)
+	if value == nil {
+		return nil, nil
+	}
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, &InvalidError{Key: key, Reason: fmt.Sprintf("has invalid value of type %T (expected a map)", value)}
+	}
+	return m, nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package deploy
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go-cli/internal/cluster"
+	cfg "go-cli/internal/config"
+	"go-cli/internal/kube"
+)
+
+// kubeContext is the context selected with --kube-context, empty to use the current one
+var kubeContext string
+
+// SetKubeContext selects the kubeconfig context Helm operations run against.
+func SetKubeContext(name string) {
+	kubeContext = name
+}
+
+// UnsafeContextError reports a kubeconfig context go-cli refuses to deploy to.
+type UnsafeContextError struct {
+	Context string
+	Allowed []string
+}
+
+func (e *UnsafeContextError) Error() string {
+	return fmt.Sprintf("refusing to run helm against kube context '%s', allowed contexts are %s (run 'go-cli cluster use', pass --kube-context or add the context to allowed_kube_contexts)", e.Context, strings.Join(e.Allowed, ", "))
+}
+
+// KubeContext returns the context Helm operations run against: the one
+// selected with --kube-context, else the current one, else the context of the
+// active cluster. Only the active cluster and the contexts listed in
+// allowed_kube_contexts are accepted.
+func KubeContext() (string, error) {
+	context := kubeContext
+	if context == "" {
+		current, err := kube.CurrentContext()
+		if err != nil {
+			return "", err
+		}
+		context = current
+	}
+
+	active := cluster.KubeContext(cluster.ActiveName())
+	if context == "" {
+		return active, nil
+	}
+
+	var allowed []string
+	if err := viper.UnmarshalKey("allowed_kube_contexts", &allowed); err != nil {
+		return "", cfg.Invalid("allowed_kube_contexts", err)
+	}
+	allowed = append([]string{active}, allowed...)
+	if !slices.Contains(allowed, context) {
+		return "", &UnsafeContextError{Context: context, Allowed: allowed}
+	}
+	return context, nil
+}
+
+// kubeContextArgs targets the checked kube context explicitly, so helm cannot
+// pick another one.
+func kubeContextArgs() ([]string, error) {
+	context, err := KubeContext()
+	if err != nil {
+		return nil, err
+	}
+	return []string{"--kube-context", context}, nil
+}
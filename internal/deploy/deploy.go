@@ -23,37 +23,84 @@ package deploy
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
 	"path/filepath"
+	"sync"
 	
 	"github.com/spf13/viper"
+	"go-cli/internal/build"
+	cfg "go-cli/internal/config"
 	"go-cli/internal/helm"
+	"go-cli/internal/runner"
 )
 
+var cmdRunner runner.Runner = runner.Exec{}
+
+// Helm repositories only need to be configured once per process
+var (
+	reposMu         sync.Mutex
+	reposConfigured bool
+)
+
+// SetRunner replaces the runner used to invoke helm.
+func SetRunner(r runner.Runner) {
+	cmdRunner = r
+}
+
 type AppConfig struct {
-	ProjectPath string        `mapstructure:"project_path"`
-	Install     InstallConfig `mapstructure:"install"`
+	ProjectPath string             `mapstructure:"project_path"`
+	Build       build.BuildDetails `mapstructure:"build"`
+	Install     InstallConfig      `mapstructure:"install"`
+	DependsOn   []string           `mapstructure:"depends_on"`
 }
 
 type InstallConfig struct {
-	ChartPath  string `mapstructure:"chart_path"`
-	ValuesFile string `mapstructure:"values_file"`
-	Namespace  string `mapstructure:"namespace"`
+	ChartPath   string            `mapstructure:"chart_path"`
+	ValuesFile  string            `mapstructure:"values_file"`
+	ValuesFiles []string          `mapstructure:"values_files"`
+	Values      map[string]any    `mapstructure:"values"`
+	Namespace   string            `mapstructure:"namespace"`
+	ImageValues ImageValuesConfig `mapstructure:"image_values"`
+
+	// wait, timeout, atomic and wait_for_jobs
+	ReleaseOptions `mapstructure:",squash"`
+
+	// Values given on the command line
+	Overrides ValueOverrides `mapstructure:"-"`
+}
+
+// ImageValuesConfig names the Helm value paths receiving the built image
+type ImageValuesConfig struct {
+	Repository string `mapstructure:"repository"`
+	Tag        string `mapstructure:"tag"`
 }
 
 type DependencyConfig struct {
-	ChartName   string `mapstructure:"chart_name"`
-	ValuesFile  string `mapstructure:"values_file"`
-	Version     string `mapstructure:"version"`
-	Namespace   string `mapstructure:"namespace"`
+	ChartName   string         `mapstructure:"chart_name"`
+	ValuesFile  string         `mapstructure:"values_file"`
+	ValuesFiles []string       `mapstructure:"values_files"`
+	Values      map[string]any `mapstructure:"values"`
+	Version     string         `mapstructure:"version"`
+	Namespace   string         `mapstructure:"namespace"`
+	DependsOn   []string       `mapstructure:"depends_on"`
+
+	// wait, timeout, atomic and wait_for_jobs
+	ReleaseOptions `mapstructure:",squash"`
+
+	// Values given on the command line
+	Overrides ValueOverrides `mapstructure:"-"`
 }
 
 
 
 func InstallDependency(depName string, depConfig DependencyConfig, verbose bool) error {
+	// Refuse to touch a cluster go-cli does not manage
+	contextArgs, err := kubeContextArgs()
+	if err != nil {
+		return err
+	}
+
 	// Configure Helm repositories before installation
-	if err := configureHelmRepos(verbose); err != nil {
+	if err := ConfigureHelmRepos(verbose); err != nil {
 		return fmt.Errorf("failed to configure helm repositories: %w", err)
 	}
 	
@@ -70,20 +117,32 @@ func InstallDependency(depName string, depConfig DependencyConfig, verbose bool)
 		args = append(args, "--namespace", depConfig.Namespace, "--create-namespace")
 	}
 	
-	// Add values file if specified
-	if depConfig.ValuesFile != "" {
-		args = append(args, "-f", depConfig.ValuesFile)
+	// Add values files in order (relative to the working directory or absolute),
+	// then the inline values and the command line overrides
+	valuesArgs, err := valuesFileArgs("", append([]string{depConfig.ValuesFile}, depConfig.ValuesFiles...)...)
+	if err != nil {
+		return err
 	}
-
-	// Execute Helm command
-	cmd := exec.Command("helm", args...)
-	
-	if verbose {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+	args = append(args, valuesArgs...)
+	inlineArgs, err := inlineValuesArgs("dependencies." + depName + ".values")
+	if err != nil {
+		return err
 	}
-	
-	if err := cmd.Run(); err != nil {
+	args = append(args, inlineArgs...)
+	overrideArgs, err := depConfig.Overrides.fileArgs()
+	if err != nil {
+		return err
+	}
+	args = append(args, overrideArgs...)
+	args = append(args, depConfig.Overrides.setArgs()...)
+
+	// Wait for the release when configured
+	args = append(args, depConfig.ReleaseOptions.args()...)
+
+	// Execute Helm command against the checked kube context
+	args = append(args, contextArgs...)
+	if err := cmdRunner.Run(runner.Command(verbose, "helm", args...)); err != nil {
+		err = releaseFailed(err, depName, depConfig.Namespace, depConfig.ReleaseOptions, contextArgs, verbose)
 		return fmt.Errorf("helm installation failed for dependency '%s': %w", depName, err)
 	}
 
@@ -91,6 +150,12 @@ func InstallDependency(depName string, depConfig DependencyConfig, verbose bool)
 }
 
 func UninstallDependency(depName string, depConfig DependencyConfig, verbose bool) error {
+	// Refuse to touch a cluster go-cli does not manage
+	contextArgs, err := kubeContextArgs()
+	if err != nil {
+		return err
+	}
+
 	// Build Helm uninstall command
 	args := []string{"uninstall", depName}
 	
@@ -99,15 +164,9 @@ func UninstallDependency(depName string, depConfig DependencyConfig, verbose boo
 		args = append(args, "--namespace", depConfig.Namespace)
 	}
 
-	// Execute Helm command
-	cmd := exec.Command("helm", args...)
-	
-	if verbose {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-	}
-	
-	if err := cmd.Run(); err != nil {
+	// Execute Helm command against the checked kube context
+	args = append(args, contextArgs...)
+	if err := cmdRunner.Run(runner.Command(verbose, "helm", args...)); err != nil {
 		return fmt.Errorf("helm uninstall failed for dependency '%s': %w", depName, err)
 	}
 
@@ -115,6 +174,12 @@ func UninstallDependency(depName string, depConfig DependencyConfig, verbose boo
 }
 
 func UninstallApp(config AppConfig, appName string, verbose bool) error {
+	// Refuse to touch a cluster go-cli does not manage
+	contextArgs, err := kubeContextArgs()
+	if err != nil {
+		return err
+	}
+
 	// Build Helm uninstall command
 	args := []string{"uninstall", appName}
 	
@@ -123,22 +188,26 @@ func UninstallApp(config AppConfig, appName string, verbose bool) error {
 		args = append(args, "--namespace", config.Install.Namespace)
 	}
 
-	// Execute Helm command
-	cmd := exec.Command("helm", args...)
-	
-	if verbose {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-	}
-	
-	if err := cmd.Run(); err != nil {
+	// Execute Helm command against the checked kube context
+	args = append(args, contextArgs...)
+	if err := cmdRunner.Run(runner.Command(verbose, "helm", args...)); err != nil {
 		return fmt.Errorf("helm uninstall failed for application '%s': %w", appName, err)
 	}
 
 	return nil
 }
 
-func configureHelmRepos(verbose bool) error {
+// ConfigureHelmRepos adds the missing helm_repositories and updates the ones
+// whose index is older than helm_repositories_ttl or misses a pinned
+// dependency version. It only talks to Helm the first time it succeeds in a process.
+func ConfigureHelmRepos(verbose bool) error {
+	reposMu.Lock()
+	defer reposMu.Unlock()
+
+	if reposConfigured {
+		return nil
+	}
+
 	// Read repositories configuration
 	var repos map[string]helm.RepoConfig
 	if err := viper.UnmarshalKey("helm_repositories", &repos); err != nil {
@@ -150,58 +219,138 @@ func configureHelmRepos(verbose bool) error {
 	if len(repos) == 0 {
 		return nil
 	}
+
+	ttl := helm.DefaultRepoTTL
+	if viper.IsSet("helm_repositories_ttl") {
+		if err := viper.UnmarshalKey("helm_repositories_ttl", &ttl); err != nil {
+			return cfg.Invalid("helm_repositories_ttl", err)
+		}
+	}
+
+	// Pinned dependency versions missing from a cached index force its update
+	var dependencies map[string]DependencyConfig
+	if err := viper.UnmarshalKey("dependencies", &dependencies); err != nil {
+		return cfg.Invalid("dependencies", err)
+	}
+	var charts []helm.Chart
+	for _, dep := range dependencies {
+		charts = append(charts, helm.Chart{Name: dep.ChartName, Version: dep.Version})
+	}
 	
-	return helm.ConfigureRepos(repos, verbose)
+	if err := helm.ConfigureRepos(repos, ttl, charts, verbose); err != nil {
+		return err
+	}
+
+	reposConfigured = true
+	return nil
 }
 
 func InstallApp(config AppConfig, appName string, verbose bool) error {
+	// Refuse to touch a cluster go-cli does not manage
+	contextArgs, err := kubeContextArgs()
+	if err != nil {
+		return err
+	}
+
 	// Configure Helm repositories before installation
-	if err := configureHelmRepos(verbose); err != nil {
+	if err := ConfigureHelmRepos(verbose); err != nil {
 		return fmt.Errorf("failed to configure helm repositories: %w", err)
 	}
 	
 	// Validate required fields
 	if config.Install.ChartPath == "" {
-		return fmt.Errorf("chart_path is required")
+		return cfg.Required("chart_path")
 	}
-	if config.Install.ValuesFile == "" {
-		return fmt.Errorf("values_file is required")
+	if config.Install.ValuesFile == "" && len(config.Install.ValuesFiles) == 0 && len(config.Install.Values) == 0 && len(config.Install.Overrides.Files) == 0 {
+		return cfg.Required("values_file")
 	}
 	if config.Install.Namespace == "" {
-		return fmt.Errorf("namespace is required")
+		return cfg.Required("namespace")
 	}
 
-	// Change to project directory
-	if err := os.Chdir(config.ProjectPath); err != nil {
-		return fmt.Errorf("failed to change to project directory '%s': %w", config.ProjectPath, err)
+	// Paths are resolved against the project directory without changing the process working directory
+	projectDir, err := build.ProjectDir(config.ProjectPath)
+	if err != nil {
+		return err
 	}
 
 	// Resolve chart path (relative to project or absolute)
 	chartPath := config.Install.ChartPath
 	if !filepath.IsAbs(chartPath) {
-		chartPath = filepath.Join(config.ProjectPath, chartPath)
-	}
-
-	// Resolve values file path (relative to project or absolute)
-	valuesPath := config.Install.ValuesFile
-	if !filepath.IsAbs(valuesPath) {
-		valuesPath = filepath.Join(config.ProjectPath, valuesPath)
+		chartPath = filepath.Join(projectDir, chartPath)
 	}
 
 	// Build Helm command
-	args := []string{"upgrade", "--install", appName, chartPath, "-f", valuesPath, "--namespace", config.Install.Namespace, "--create-namespace"}
+	args := []string{"upgrade", "--install", appName, chartPath, "--namespace", config.Install.Namespace, "--create-namespace"}
 
-	// Execute Helm command
-	cmd := exec.Command("helm", args...)
-	
-	if verbose {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+	// Add values files in order (relative to project or absolute), then the
+	// inline values and the --values files
+	valuesArgs, err := valuesFileArgs(projectDir, append([]string{config.Install.ValuesFile}, config.Install.ValuesFiles...)...)
+	if err != nil {
+		return err
 	}
-	
-	if err := cmd.Run(); err != nil {
+	args = append(args, valuesArgs...)
+	inlineArgs, err := inlineValuesArgs("apps." + appName + ".install.values")
+	if err != nil {
+		return err
+	}
+	args = append(args, inlineArgs...)
+	overrideArgs, err := config.Install.Overrides.fileArgs()
+	if err != nil {
+		return err
+	}
+	args = append(args, overrideArgs...)
+
+	// Point the release at the built image
+	imageArgs, err := imageSetArgs(config)
+	if err != nil {
+		return err
+	}
+	args = append(args, imageArgs...)
+
+	// --set values take precedence over the image
+	args = append(args, config.Install.Overrides.setArgs()...)
+
+	// Wait for the release when configured
+	args = append(args, config.Install.ReleaseOptions.args()...)
+
+	// Execute Helm command against the checked kube context
+	args = append(args, contextArgs...)
+	if err := cmdRunner.Run(runner.Command(verbose, "helm", args...)); err != nil {
+		err = releaseFailed(err, appName, config.Install.Namespace, config.Install.ReleaseOptions, contextArgs, verbose)
 		return fmt.Errorf("helm installation failed: %w", err)
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// imageSetArgs returns the --set arguments injecting the built image into the
+// value paths declared in image_values. Apps publishing their image without
+// declaring paths use image.repository and image.tag.
+func imageSetArgs(config AppConfig) ([]string, error) {
+	values := config.Install.ImageValues
+	if values.Repository == "" && values.Tag == "" {
+		if config.Build.Publish.Mode == "" {
+			return nil, nil
+		}
+		values = ImageValuesConfig{Repository: "image.repository", Tag: "image.tag"}
+	}
+	if config.Build.ImageName == "" {
+		return nil, &cfg.InvalidError{Key: "image_values", Reason: "requires build.image_name"}
+	}
+
+	ref, err := build.ImageRef(build.BuildConfig{ProjectPath: config.ProjectPath, Build: config.Build})
+	if err != nil {
+		return nil, err
+	}
+	repository, tag := build.SplitImageRef(ref)
+
+	var args []string
+	if values.Repository != "" {
+		args = append(args, "--set-string", values.Repository+"="+repository)
+	}
+	if values.Tag != "" {
+		args = append(args, "--set-string", values.Tag+"="+tag)
+	}
+	return args, nil
+}
@@ -0,0 +1,419 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package deploy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	cfg "go-cli/internal/config"
+	"go-cli/internal/helm"
+	"go-cli/internal/runner"
+)
+
+// useRecorder records the helm and kubectl commands, answering them with
+// replies, against the context of the default cluster. The configuration is
+// read from config, an empty one when config is empty.
+func useRecorder(t *testing.T, config string, replies map[string]runner.Reply) (*runner.Recorder, string) {
+	t.Helper()
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+
+	viper.Reset()
+	if config != "" {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		viper.SetConfigFile(path)
+	}
+	if err := cfg.Load(""); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := &runner.Recorder{Stub: runner.StubReplies(replies)}
+	SetRunner(recorder)
+	helm.SetRunner(recorder)
+	SetKubeContext("k3d-local")
+	reposConfigured = false
+	t.Cleanup(func() {
+		SetRunner(runner.Exec{})
+		helm.SetRunner(runner.Exec{})
+		SetKubeContext("")
+		viper.Reset()
+		cfg.Load("")
+	})
+	return recorder, filepath.Join(cacheDir, "cli")
+}
+
+// expand replaces the {project} and {cache} placeholders of lines.
+func expand(lines []string, project string, cacheDir string) []string {
+	replacer := strings.NewReplacer("{project}", project, "{cache}", cacheDir)
+	var expanded []string
+	for _, line := range lines {
+		expanded = append(expanded, replacer.Replace(line))
+	}
+	return expanded
+}
+
+func TestInstallApp(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := &runner.ToolFailedError{Tool: "helm", ExitCode: 1, Stderr: "Error: UPGRADE FAILED: context deadline exceeded"}
+	renderFailed := &runner.ToolFailedError{Tool: "helm", ExitCode: 1, Stderr: "Error: INSTALLATION FAILED: template: api/templates/deployment.yaml:12:20: executing \"api\" at <.Values.image.tag>: nil pointer"}
+	rollbackFailed := &runner.ToolFailedError{Tool: "helm", ExitCode: 1, Stderr: "Error: release api failed: timed out waiting for the condition"}
+	uninstallFailed := &runner.ToolFailedError{Tool: "helm", ExitCode: 1, Stderr: "Error: uninstallation completed with 1 error(s): namespaces \"app\" not found"}
+
+	tests := []struct {
+		name      string
+		config    string
+		install   InstallConfig
+		build     func(project string) AppConfig
+		replies   map[string]runner.Reply
+		wantLines []string
+		wantFile  string
+		wantErr   bool
+		// Errors the returned error wraps
+		wantErrs []error
+	}{
+		{
+			name:    "values file",
+			install: InstallConfig{ChartPath: "./chart", ValuesFile: "values.yaml", Namespace: "app"},
+			wantLines: []string{
+				"helm upgrade --install api {project}/chart --namespace app --create-namespace -f {project}/values.yaml --kube-context k3d-local",
+			},
+		},
+		{
+			name: "layered values",
+			config: `apps:
+  api:
+    install:
+      values:
+        podAnnotations:
+          Team: core
+`,
+			install: InstallConfig{
+				ChartPath:      "/charts/api",
+				ValuesFile:     "values.yaml",
+				ValuesFiles:    []string{"values-dev.yaml", "/shared/values.yaml"},
+				Namespace:      "app",
+				ReleaseOptions: ReleaseOptions{Wait: true, Timeout: 10 * time.Minute},
+				Overrides:      ValueOverrides{Files: []string{"override.yaml"}, Set: []string{"replicas=2"}, SetString: []string{"tag=1.0"}},
+			},
+			wantLines: []string{
+				"helm upgrade --install api /charts/api --namespace app --create-namespace -f {project}/values.yaml -f {project}/values-dev.yaml" +
+					" -f /shared/values.yaml -f {cache}/values/apps.api.install.values.yaml -f " + cwd + "/override.yaml" +
+					" --set replicas=2 --set-string tag=1.0 --wait --timeout 10m0s --kube-context k3d-local",
+			},
+			wantFile: "podAnnotations:\n    Team: core\n",
+		},
+		{
+			name: "published image",
+			build: func(project string) AppConfig {
+				config := AppConfig{ProjectPath: project, Install: InstallConfig{ChartPath: "chart", ValuesFile: "values.yaml", Namespace: "app"}}
+				config.Build.ImageName = "api:local"
+				config.Build.Publish.Mode = "registry"
+				config.Build.Publish.Registry = "localhost:5050"
+				return config
+			},
+			wantLines: []string{
+				"helm upgrade --install api {project}/chart --namespace app --create-namespace -f {project}/values.yaml" +
+					" --set-string image.repository=localhost:5050/api --set-string image.tag=local --kube-context k3d-local",
+			},
+		},
+		{
+			name:    "missing namespace",
+			install: InstallConfig{ChartPath: "chart", ValuesFile: "values.yaml"},
+			wantErr: true,
+		},
+		{
+			name:    "atomic release rolled back after the diagnostics",
+			install: InstallConfig{ChartPath: "chart", ValuesFile: "values.yaml", Namespace: "app", ReleaseOptions: ReleaseOptions{Atomic: true}},
+			replies: map[string]runner.Reply{
+				"helm upgrade": {Err: failed},
+				"kubectl --context k3d-local --namespace app get pods": {Output: `{"items": [{"metadata": {"name": "api-0"}, "status": {"phase": "Running",
+					"containerStatuses": [{"name": "api", "ready": false, "restartCount": 2, "state": {"waiting": {"reason": "CrashLoopBackOff"}}}]}}]}`},
+				"kubectl --context k3d-local --namespace app logs": {Output: "starting\npanic: no database\n"},
+				"helm history": {Output: `[{"revision": 1, "status": "superseded"}, {"revision": 2, "status": "failed"}]`},
+			},
+			wantLines: []string{
+				"helm upgrade --install api {project}/chart --namespace app --create-namespace -f {project}/values.yaml --wait --kube-context k3d-local",
+				"kubectl --context k3d-local --namespace app get pods --selector app.kubernetes.io/instance=api -o json",
+				"kubectl --context k3d-local --namespace app logs api-0 --container api --tail=20 --previous",
+				"kubectl --context k3d-local --namespace app get events --field-selector involvedObject.name=api-0 --sort-by .lastTimestamp",
+				"helm history api --max 2 -o json --namespace app --kube-context k3d-local",
+				"helm rollback api --wait --namespace app --kube-context k3d-local",
+			},
+			wantErr: true,
+		},
+		{
+			name:    "atomic first install uninstalled",
+			install: InstallConfig{ChartPath: "chart", ValuesFile: "values.yaml", Namespace: "app", ReleaseOptions: ReleaseOptions{Atomic: true}},
+			replies: map[string]runner.Reply{
+				"helm upgrade": {Err: failed},
+				"kubectl":      {Output: `{"items": []}`},
+				"helm history": {Output: `[{"revision": 1, "status": "failed"}]`},
+			},
+			wantLines: []string{
+				"helm upgrade --install api {project}/chart --namespace app --create-namespace -f {project}/values.yaml --wait --kube-context k3d-local",
+				"kubectl --context k3d-local --namespace app get pods --selector app.kubernetes.io/instance=api -o json",
+				"helm history api --max 2 -o json --namespace app --kube-context k3d-local",
+				"helm uninstall api --namespace app --kube-context k3d-local",
+			},
+			wantErr: true,
+		},
+		{
+			name:    "chart failure not diagnosed",
+			install: InstallConfig{ChartPath: "chart", ValuesFile: "values.yaml", Namespace: "app", ReleaseOptions: ReleaseOptions{Wait: true}},
+			replies: map[string]runner.Reply{"helm upgrade": {Err: renderFailed}},
+			wantLines: []string{
+				"helm upgrade --install api {project}/chart --namespace app --create-namespace -f {project}/values.yaml --wait --kube-context k3d-local",
+			},
+			wantErr:  true,
+			wantErrs: []error{renderFailed},
+		},
+		{
+			name:    "atomic rollback failed",
+			install: InstallConfig{ChartPath: "chart", ValuesFile: "values.yaml", Namespace: "app", ReleaseOptions: ReleaseOptions{Atomic: true}},
+			replies: map[string]runner.Reply{
+				"helm upgrade":  {Err: failed},
+				"kubectl":       {Output: `{"items": []}`},
+				"helm history":  {Output: `[{"revision": 1, "status": "superseded"}, {"revision": 2, "status": "failed"}]`},
+				"helm rollback": {Err: rollbackFailed},
+			},
+			wantLines: []string{
+				"helm upgrade --install api {project}/chart --namespace app --create-namespace -f {project}/values.yaml --wait --kube-context k3d-local",
+				"kubectl --context k3d-local --namespace app get pods --selector app.kubernetes.io/instance=api -o json",
+				"helm history api --max 2 -o json --namespace app --kube-context k3d-local",
+				"helm rollback api --wait --namespace app --kube-context k3d-local",
+			},
+			wantErr:  true,
+			wantErrs: []error{failed, rollbackFailed},
+		},
+		{
+			name:    "atomic uninstall failed",
+			install: InstallConfig{ChartPath: "chart", ValuesFile: "values.yaml", Namespace: "app", ReleaseOptions: ReleaseOptions{Atomic: true}},
+			replies: map[string]runner.Reply{
+				"helm upgrade":   {Err: failed},
+				"kubectl":        {Output: `{"items": []}`},
+				"helm history":   {Output: `[{"revision": 1, "status": "failed"}]`},
+				"helm uninstall": {Err: uninstallFailed},
+			},
+			wantLines: []string{
+				"helm upgrade --install api {project}/chart --namespace app --create-namespace -f {project}/values.yaml --wait --kube-context k3d-local",
+				"kubectl --context k3d-local --namespace app get pods --selector app.kubernetes.io/instance=api -o json",
+				"helm history api --max 2 -o json --namespace app --kube-context k3d-local",
+				"helm uninstall api --namespace app --kube-context k3d-local",
+			},
+			wantErr:  true,
+			wantErrs: []error{failed, uninstallFailed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, cacheDir := useRecorder(t, tt.config, tt.replies)
+			project := t.TempDir()
+			config := AppConfig{ProjectPath: project, Install: tt.install}
+			if tt.build != nil {
+				config = tt.build(project)
+			}
+
+			err := InstallApp(config, "api", false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InstallApp() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, want := range tt.wantErrs {
+				if !errors.Is(err, want) {
+					t.Errorf("InstallApp() error = %v, want it to wrap %v", err, want)
+				}
+			}
+			if want := expand(tt.wantLines, project, cacheDir); !reflect.DeepEqual(recorder.Lines(), want) {
+				t.Errorf("InstallApp() ran\n%q\nwant\n%q", recorder.Lines(), want)
+			}
+			if tt.wantFile != "" {
+				got, _ := recorder.File(filepath.Join(cacheDir, "values", "apps.api.install.values.yaml"))
+				if string(got) != tt.wantFile {
+					t.Errorf("inline values =\n%s\nwant\n%s", got, tt.wantFile)
+				}
+			}
+		})
+	}
+}
+
+func TestInstallAppNotReady(t *testing.T) {
+	useRecorder(t, "", map[string]runner.Reply{
+		"helm upgrade": {Err: &runner.ToolFailedError{Tool: "helm", ExitCode: 1, Stderr: "Error: INSTALLATION FAILED: timed out waiting for the condition\n"}},
+		"kubectl --context k3d-local --namespace app get pods": {Output: `{"items": [
+			{"metadata": {"name": "api-0"}, "status": {"phase": "Pending", "containerStatuses": [{"name": "api", "state": {"waiting": {"reason": "ImagePullBackOff"}}}]}},
+			{"metadata": {"name": "migrate"}, "status": {"phase": "Succeeded"}}]}`},
+		"kubectl --context k3d-local --namespace app get events": {Output: "LAST SEEN   TYPE      REASON\n1s          Warning   Failed\n"},
+	})
+
+	config := AppConfig{ProjectPath: t.TempDir(), Install: InstallConfig{ChartPath: "chart", ValuesFile: "values.yaml", Namespace: "app", ReleaseOptions: ReleaseOptions{Wait: true}}}
+	err := InstallApp(config, "api", false)
+
+	var notReady *NotReadyError
+	if !errors.As(err, &notReady) {
+		t.Fatalf("InstallApp() error = %v, want a NotReadyError", err)
+	}
+	want := []PodReport{{
+		Name:       "api-0",
+		Status:     "ImagePullBackOff",
+		Events:     []string{"LAST SEEN   TYPE      REASON", "1s          Warning   Failed"},
+		Logs:       map[string][]string{"api": nil},
+		Containers: []string{"api"},
+	}}
+	if !reflect.DeepEqual(notReady.Pods, want) {
+		t.Errorf("NotReadyError.Pods = %+v, want %+v", notReady.Pods, want)
+	}
+}
+
+func TestInstallDependency(t *testing.T) {
+	tests := []struct {
+		name       string
+		dependency DependencyConfig
+		overrides  ValueOverrides
+		wantLines  []string
+	}{
+		{
+			name:       "chart",
+			dependency: DependencyConfig{ChartName: "bitnami/redis"},
+			wantLines:  []string{"helm upgrade --install redis bitnami/redis --kube-context k3d-local"},
+		},
+		{
+			name: "version, namespace and values",
+			dependency: DependencyConfig{
+				ChartName:      "bitnami/redis",
+				Version:        "18.1.0",
+				Namespace:      "data",
+				ValuesFile:     "/configs/redis.yaml",
+				ValuesFiles:    []string{"/configs/redis-dev.yaml"},
+				ReleaseOptions: ReleaseOptions{WaitForJobs: true},
+				Overrides:      ValueOverrides{Set: []string{"auth.enabled=false"}},
+			},
+			wantLines: []string{
+				"helm upgrade --install redis bitnami/redis --version 18.1.0 --namespace data --create-namespace" +
+					" -f /configs/redis.yaml -f /configs/redis-dev.yaml --set auth.enabled=false --wait --wait-for-jobs --kube-context k3d-local",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, _ := useRecorder(t, "", nil)
+
+			if err := InstallDependency("redis", tt.dependency, false); err != nil {
+				t.Fatal(err)
+			}
+			if got := recorder.Lines(); !reflect.DeepEqual(got, tt.wantLines) {
+				t.Errorf("InstallDependency() ran\n%q\nwant\n%q", got, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestInstallDependencyConfiguresRepositories(t *testing.T) {
+	recorder, _ := useRecorder(t, `helm_repositories:
+  bitnami:
+    url: https://charts.bitnami.com/bitnami
+`, map[string]runner.Reply{"helm repo list": {Output: "[]"}})
+
+	if err := InstallDependency("redis", DependencyConfig{ChartName: "bitnami/redis"}, false); err != nil {
+		t.Fatal(err)
+	}
+	// Repositories are only configured once per process
+	if err := InstallDependency("redis", DependencyConfig{ChartName: "bitnami/redis"}, false); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"helm repo list -o json",
+		"helm repo add bitnami https://charts.bitnami.com/bitnami",
+		"helm upgrade --install redis bitnami/redis --kube-context k3d-local",
+		"helm upgrade --install redis bitnami/redis --kube-context k3d-local",
+	}
+	if got := recorder.Lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("InstallDependency() ran\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestUninstall(t *testing.T) {
+	tests := []struct {
+		name      string
+		uninstall func() error
+		wantLines []string
+	}{
+		{
+			name: "app",
+			uninstall: func() error {
+				return UninstallApp(AppConfig{Install: InstallConfig{Namespace: "app"}}, "api", false)
+			},
+			wantLines: []string{"helm uninstall api --namespace app --kube-context k3d-local"},
+		},
+		{
+			name: "dependency",
+			uninstall: func() error {
+				return UninstallDependency("redis", DependencyConfig{Namespace: "data"}, false)
+			},
+			wantLines: []string{"helm uninstall redis --namespace data --kube-context k3d-local"},
+		},
+		{
+			name: "dependency in the current namespace",
+			uninstall: func() error {
+				return UninstallDependency("redis", DependencyConfig{}, false)
+			},
+			wantLines: []string{"helm uninstall redis --kube-context k3d-local"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, _ := useRecorder(t, "", nil)
+
+			if err := tt.uninstall(); err != nil {
+				t.Fatal(err)
+			}
+			if got := recorder.Lines(); !reflect.DeepEqual(got, tt.wantLines) {
+				t.Errorf("uninstall ran\n%q\nwant\n%q", got, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestUnsafeContext(t *testing.T) {
+	recorder, _ := useRecorder(t, "", nil)
+	SetKubeContext("production")
+
+	err := UninstallApp(AppConfig{}, "api", false)
+	var unsafe *UnsafeContextError
+	if !errors.As(err, &unsafe) {
+		t.Fatalf("UninstallApp() error = %v, want an UnsafeContextError", err)
+	}
+	if lines := recorder.Lines(); len(lines) > 0 {
+		t.Errorf("UninstallApp() ran %q against an unsafe context", lines)
+	}
+}
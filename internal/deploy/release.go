@@ -0,0 +1,302 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package deploy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go-cli/internal/runner"
+)
+
+// ReleaseOptions control whether helm waits for a release to become ready.
+type ReleaseOptions struct {
+	Wait        bool          `mapstructure:"wait"`
+	Timeout     time.Duration `mapstructure:"timeout"`
+	Atomic      bool          `mapstructure:"atomic"`
+	WaitForJobs bool          `mapstructure:"wait_for_jobs"`
+}
+
+func (o ReleaseOptions) waits() bool {
+	return o.Wait || o.Atomic || o.WaitForJobs
+}
+
+// args returns the helm arguments of the options. Atomic releases are rolled
+// back by rollBack rather than by helm --atomic, which would replace the
+// failing pods before their diagnostics are collected.
+func (o ReleaseOptions) args() []string {
+	var args []string
+	if o.waits() {
+		args = append(args, "--wait")
+	}
+	if o.WaitForJobs {
+		args = append(args, "--wait-for-jobs")
+	}
+	if o.Timeout > 0 {
+		args = append(args, "--timeout", o.Timeout.String())
+	}
+	return args
+}
+
+// Limits keeping the diagnostics of a failed release readable
+const (
+	maxFailingPods = 3
+	eventLines     = 10
+	logLines       = 20
+)
+
+// NotReadyError reports a release helm gave up waiting for, along with what
+// its failing pods reported.
+type NotReadyError struct {
+	Release string
+	Err     error
+	Pods    []PodReport
+}
+
+// PodReport holds the recent events and container logs of a failing pod.
+type PodReport struct {
+	Name   string
+	Status string
+	Events []string
+	Logs   map[string][]string
+	// Containers in the order of the pod spec
+	Containers []string
+}
+
+func (e *NotReadyError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "release '%s' did not become ready: %v", e.Release, e.Err)
+	for _, pod := range e.Pods {
+		fmt.Fprintf(&b, "\npod %s (%s)", pod.Name, pod.Status)
+		if len(pod.Events) > 0 {
+			b.WriteString("\n  events:")
+			for _, line := range pod.Events {
+				b.WriteString("\n    " + line)
+			}
+		}
+		for _, container := range pod.Containers {
+			fmt.Fprintf(&b, "\n  last logs of %s:", container)
+			for _, line := range pod.Logs[container] {
+				b.WriteString("\n    " + line)
+			}
+		}
+	}
+	return b.String()
+}
+
+func (e *NotReadyError) Unwrap() error {
+	return e.Err
+}
+
+type podList struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Status struct {
+			Phase             string `json:"phase"`
+			ContainerStatuses []struct {
+				Name         string `json:"name"`
+				Ready        bool   `json:"ready"`
+				RestartCount int    `json:"restartCount"`
+				State        struct {
+					Waiting *struct {
+						Reason string `json:"reason"`
+					} `json:"waiting"`
+					Terminated *struct {
+						Reason string `json:"reason"`
+					} `json:"terminated"`
+				} `json:"state"`
+			} `json:"containerStatuses"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// releaseFailed explains a failed install when helm gave up waiting for the
+// release, by attaching the events and logs of its failing pods, then rolls
+// the release back when it is atomic.
+func releaseFailed(err error, release string, namespace string, options ReleaseOptions, contextArgs []string, verbose bool) error {
+	if !options.waits() {
+		return err
+	}
+	if notReady(err) {
+		err = diagnose(err, release, namespace, contextArgs)
+	}
+	if options.Atomic {
+		if rollbackErr := rollBack(release, namespace, options, contextArgs, verbose); rollbackErr != nil {
+			return errors.Join(err, rollbackErr)
+		}
+	}
+	return err
+}
+
+// What helm reports when the resources of a release are not ready in time
+var notReadyMessages = []string{"context deadline exceeded", "timed out waiting", "resource not ready", "job failed"}
+
+// notReady reports whether helm failed waiting for the release, rather than
+// before installing anything, e.g. on a chart that does not render.
+func notReady(err error) bool {
+	message := err.Error()
+	var failed *runner.ToolFailedError
+	if errors.As(err, &failed) {
+		message += "\n" + failed.Stderr
+	}
+	for _, known := range notReadyMessages {
+		if strings.Contains(message, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// diagnose attaches the events and logs of the failing pods of release to
+// err, querying the context helm ran against. Failing to collect them leaves
+// err untouched.
+func diagnose(err error, release string, namespace string, contextArgs []string) error {
+	// kubectl names the --kube-context flag of helm --context
+	kubectl := slices.Clone(contextArgs)
+	for i, arg := range kubectl {
+		if arg == "--kube-context" {
+			kubectl[i] = "--context"
+		}
+	}
+	if namespace != "" {
+		kubectl = append(kubectl, "--namespace", namespace)
+	}
+
+	pods, listErr := failingPods(kubectl, "app.kubernetes.io/instance="+release)
+	if listErr != nil || len(pods) == 0 {
+		return err
+	}
+	for i := range pods {
+		pods[i].Events = runner.LastLines(kubectlOutput(kubectl, "get", "events", "--field-selector", "involvedObject.name="+pods[i].Name, "--sort-by", ".lastTimestamp"), eventLines)
+	}
+	return &NotReadyError{Release: release, Err: err, Pods: pods}
+}
+
+// rollBack undoes a release that did not become ready as helm --atomic does:
+// a failed upgrade goes back to the previous revision and a failed first
+// install is uninstalled. A release helm did not record is left alone.
+func rollBack(release string, namespace string, options ReleaseOptions, contextArgs []string, verbose bool) error {
+	var scope []string
+	if namespace != "" {
+		scope = append(scope, "--namespace", namespace)
+	}
+	scope = append(scope, contextArgs...)
+
+	output, err := cmdRunner.Output(runner.Command(false, "helm", append([]string{"history", release, "--max", "2", "-o", "json"}, scope...)...))
+	if err != nil {
+		var failed *runner.ToolFailedError
+		if errors.As(err, &failed) && strings.Contains(failed.Stderr, "not found") {
+			return nil
+		}
+		return fmt.Errorf("failed to read the history of release '%s': %w", release, err)
+	}
+	var history []struct {
+		Revision int    `json:"revision"`
+		Status   string `json:"status"`
+	}
+	if err := json.Unmarshal(output, &history); err != nil {
+		return fmt.Errorf("failed to parse the history of release '%s': %w", release, err)
+	}
+	if len(history) == 0 || history[len(history)-1].Status == "deployed" {
+		return nil
+	}
+
+	args := []string{"uninstall", release}
+	if len(history) > 1 {
+		args = []string{"rollback", release, "--wait"}
+		if options.Timeout > 0 {
+			args = append(args, "--timeout", options.Timeout.String())
+		}
+	}
+	if err := cmdRunner.Run(runner.Command(verbose, "helm", append(args, scope...)...)); err != nil {
+		return fmt.Errorf("failed to roll back release '%s': %w", release, err)
+	}
+	return nil
+}
+
+// failingPods returns the pods matching selector that are not ready, with
+// the logs of their containers. Restarted containers show the logs of their
+// previous run, which is the one that crashed.
+func failingPods(kubectl []string, selector string) ([]PodReport, error) {
+	output, err := cmdRunner.Output(runner.Command(false, "kubectl", append(kubectl, "get", "pods", "--selector", selector, "-o", "json")...))
+	if err != nil {
+		return nil, err
+	}
+	var list podList
+	if err := json.Unmarshal(output, &list); err != nil {
+		return nil, err
+	}
+
+	var pods []PodReport
+	for _, item := range list.Items {
+		if item.Status.Phase == "Succeeded" || len(pods) == maxFailingPods {
+			continue
+		}
+
+		pod := PodReport{Name: item.Metadata.Name, Status: item.Status.Phase, Logs: map[string][]string{}}
+		ready := item.Status.Phase == "Running"
+		restarts := 0
+		for _, container := range item.Status.ContainerStatuses {
+			if container.Ready {
+				continue
+			}
+			ready = false
+			restarts += container.RestartCount
+			switch {
+			case container.State.Waiting != nil && container.State.Waiting.Reason != "":
+				pod.Status = container.State.Waiting.Reason
+			case container.State.Terminated != nil && container.State.Terminated.Reason != "":
+				pod.Status = container.State.Terminated.Reason
+			}
+
+			args := []string{"logs", pod.Name, "--container", container.Name, fmt.Sprintf("--tail=%d", logLines)}
+			if container.RestartCount > 0 {
+				args = append(args, "--previous")
+			}
+			pod.Containers = append(pod.Containers, container.Name)
+			pod.Logs[container.Name] = runner.LastLines(kubectlOutput(kubectl, args...), logLines)
+		}
+		if ready {
+			continue
+		}
+		if restarts > 0 {
+			pod.Status += fmt.Sprintf(", %d restarts", restarts)
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// kubectlOutput returns what kubectl printed, or its error when it failed.
+func kubectlOutput(kubectl []string, args ...string) string {
+	output, err := cmdRunner.Output(runner.Command(false, "kubectl", append(append([]string{}, kubectl...), args...)...))
+	if err != nil {
+		return err.Error()
+	}
+	return string(output)
+}
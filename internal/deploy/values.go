@@ -0,0 +1,102 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	cfg "go-cli/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// ValueOverrides are the values given on the command line, applied on top of
+// the configured ones.
+type ValueOverrides struct {
+	Files     []string
+	Set       []string
+	SetString []string
+}
+
+// fileArgs returns the -f arguments of the --values files, relative to the
+// working directory.
+func (o ValueOverrides) fileArgs() ([]string, error) {
+	return valuesFileArgs("", o.Files...)
+}
+
+func (o ValueOverrides) setArgs() []string {
+	var args []string
+	for _, value := range o.Set {
+		args = append(args, "--set", value)
+	}
+	for _, value := range o.SetString {
+		args = append(args, "--set-string", value)
+	}
+	return args
+}
+
+// valuesFileArgs returns the -f arguments of files in order, relative paths
+// being resolved against dir, or the working directory when dir is empty.
+func valuesFileArgs(dir string, files ...string) ([]string, error) {
+	var args []string
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		path := file
+		if dir != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid values file '%s': %w", file, err)
+		}
+		args = append(args, "-f", path)
+	}
+	return args, nil
+}
+
+// inlineValuesArgs writes the values map found at key to a file of the cache
+// directory and returns the -f argument pointing at it. The map is read back
+// from the configuration file because viper lowercases its keys.
+func inlineValuesArgs(key string) ([]string, error) {
+	values, err := cfg.RawMap(key)
+	if err != nil || len(values) == 0 {
+		return nil, err
+	}
+
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, cfg.Invalid(key, err)
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user cache directory: %w", err)
+	}
+	path := filepath.Join(cacheDir, "cli", "values", key+".yaml")
+	if err := cmdRunner.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return []string{"-f", path}, nil
+}
@@ -0,0 +1,256 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package dev
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go-cli/internal/build"
+	"go-cli/internal/deploy"
+)
+
+const defaultDebounce = 500 * time.Millisecond
+
+// Directories never worth watching
+var defaultExcludes = []string{".git/**"}
+
+type Config struct {
+	Include  []string      `mapstructure:"include"`
+	Exclude  []string      `mapstructure:"exclude"`
+	Debounce time.Duration `mapstructure:"debounce"`
+}
+
+// Cycle is the outcome of one rebuild and redeploy of the app.
+type Cycle struct {
+	Changed         []string
+	BuildDuration   time.Duration
+	BuildErr        error
+	InstallDuration time.Duration
+	InstallErr      error
+}
+
+// Watch rebuilds, publishes and reinstalls the app every time files matching
+// the include/exclude globs change under its project path, until ctx is done.
+// A first cycle runs immediately. Failed cycles are reported and watching continues.
+func Watch(ctx context.Context, appName string, app deploy.AppConfig, config Config, verbose bool, report func(Cycle)) error {
+	root, err := filepath.Abs(app.ProjectPath)
+	if err != nil {
+		return err
+	}
+
+	include, err := compileGlobs(config.Include)
+	if err != nil {
+		return err
+	}
+	exclude, err := compileGlobs(append(append([]string(nil), defaultExcludes...), config.Exclude...))
+	if err != nil {
+		return err
+	}
+
+	debounce := config.Debounce
+	if debounce <= 0 {
+		debounce = defaultDebounce
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := addTree(watcher, root, exclude); err != nil {
+		return err
+	}
+
+	// A tag following the image content gives every rebuild a new image
+	// reference, so Helm rolls the pods out instead of keeping the old image
+	app.Build.Tag = build.TagDigest
+
+	run := func(changed []string) Cycle {
+		cycle := Cycle{Changed: changed}
+
+		start := time.Now()
+		cycle.BuildErr = build.Build(build.BuildConfig{ProjectPath: app.ProjectPath, Build: app.Build}, verbose)
+		cycle.BuildDuration = time.Since(start)
+		if cycle.BuildErr != nil {
+			return cycle
+		}
+
+		start = time.Now()
+		cycle.InstallErr = deploy.InstallApp(app, appName, verbose)
+		cycle.InstallDuration = time.Since(start)
+		return cycle
+	}
+
+	changed := make(map[string]bool)
+	done := make(chan Cycle)
+	running := true
+	go func() { done <- run(nil) }()
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if running {
+				report(<-done)
+			}
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			rel, err := filepath.Rel(root, event.Name)
+			if err != nil {
+				continue
+			}
+			rel = filepath.ToSlash(rel)
+
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := addTree(watcher, event.Name, exclude); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+
+			if matchAny(exclude, rel) || (len(include) > 0 && !matchAny(include, rel)) {
+				continue
+			}
+			changed[rel] = true
+			timer.Reset(debounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return fmt.Errorf("file watcher failed: %w", err)
+
+		case <-timer.C:
+			if running || len(changed) == 0 {
+				continue
+			}
+			files := make([]string, 0, len(changed))
+			for file := range changed {
+				files = append(files, file)
+			}
+			sort.Strings(files)
+			changed = make(map[string]bool)
+
+			running = true
+			go func() { done <- run(files) }()
+
+		case cycle := <-done:
+			running = false
+			report(cycle)
+			// Changes made during the cycle trigger the next one
+			if len(changed) > 0 {
+				timer.Reset(debounce)
+			}
+		}
+	}
+}
+
+// addTree watches dir and all of its subdirectories that are not excluded.
+func addTree(watcher *fsnotify.Watcher, dir string, exclude []*regexp.Regexp) error {
+	root := dir
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if rel, err := filepath.Rel(root, path); err == nil && rel != "." && matchAny(exclude, filepath.ToSlash(rel)+"/") {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch '%s': %w", path, err)
+		}
+		return nil
+	})
+}
+
+// compileGlobs turns globs into regular expressions. "*" and "?" do not cross
+// directories, "**" does, and a glob without "/" matches a file or directory name
+// in any directory, along with everything under that directory.
+func compileGlobs(globs []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, glob := range globs {
+		pattern := strings.TrimPrefix(filepath.ToSlash(glob), "./")
+		var expr strings.Builder
+		if !strings.Contains(pattern, "/") {
+			expr.WriteString("^(.*/)?")
+		} else {
+			expr.WriteString("^")
+		}
+
+		for i := 0; i < len(pattern); i++ {
+			switch c := pattern[i]; {
+			case strings.HasPrefix(pattern[i:], "**/"):
+				expr.WriteString("(.*/)?")
+				i += 2
+			case strings.HasPrefix(pattern[i:], "**"):
+				expr.WriteString(".*")
+				i++
+			case c == '*':
+				expr.WriteString("[^/]*")
+			case c == '?':
+				expr.WriteString("[^/]")
+			default:
+				expr.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		}
+		if !strings.Contains(pattern, "/") {
+			expr.WriteString("(/.*)?")
+		}
+		expr.WriteString("$")
+
+		re, err := regexp.Compile(expr.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob '%s': %w", glob, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+func matchAny(globs []*regexp.Regexp, path string) bool {
+	for _, re := range globs {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,234 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package dev
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go-cli/internal/build"
+	"go-cli/internal/deploy"
+	"go-cli/internal/runner"
+)
+
+func TestCompileGlobs(t *testing.T) {
+	tests := []struct {
+		glob  string
+		match []string
+		skip  []string
+	}{
+		{
+			glob:  "node_modules",
+			match: []string{"node_modules", "node_modules/", "node_modules/a.js", "web/node_modules/lib/b.js"},
+			skip:  []string{"node_modules.txt", "my_node_modules/a.js"},
+		},
+		{
+			glob:  "*.log",
+			match: []string{"app.log", "logs/app.log"},
+			skip:  []string{"app.log.txt", "app.go"},
+		},
+		{
+			glob:  "node_modules/**",
+			match: []string{"node_modules/", "node_modules/a.js", "node_modules/lib/b.js"},
+			skip:  []string{"web/node_modules/a.js"},
+		},
+		{
+			glob:  "src/*.go",
+			match: []string{"src/main.go"},
+			skip:  []string{"src/cmd/main.go", "main.go"},
+		},
+		{
+			glob:  "src/**/*.go",
+			match: []string{"src/main.go", "src/cmd/main.go"},
+			skip:  []string{"main.go", "src/main.go.orig"},
+		},
+		{
+			glob:  "./Dockerfile",
+			match: []string{"Dockerfile", "docker/Dockerfile"},
+			skip:  []string{"Dockerfile.dev"},
+		},
+		{
+			glob:  "file?.txt",
+			match: []string{"file1.txt"},
+			skip:  []string{"file10.txt", "file/.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.glob, func(t *testing.T) {
+			globs, err := compileGlobs([]string{tt.glob})
+			if err != nil {
+				t.Fatalf("compileGlobs() error = %v", err)
+			}
+			for _, path := range tt.match {
+				if !matchAny(globs, path) {
+					t.Errorf("'%s' does not match '%s'", tt.glob, path)
+				}
+			}
+			for _, path := range tt.skip {
+				if matchAny(globs, path) {
+					t.Errorf("'%s' matches '%s'", tt.glob, path)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchAnyWithoutGlobs(t *testing.T) {
+	if matchAny(nil, "main.go") {
+		t.Error("matchAny() without globs matches")
+	}
+}
+
+// watchLoop runs Watch on a temporary project whose docker builds wait for the
+// test: every build sends on started, then fails once release is closed or written to.
+func watchLoop(t *testing.T) (project string, started chan struct{}, release chan struct{}, cycles chan Cycle) {
+	t.Helper()
+	project = t.TempDir()
+	started = make(chan struct{}, 10)
+	release = make(chan struct{}, 10)
+	cycles = make(chan Cycle, 10)
+
+	recorder := &runner.Recorder{Stub: func(cmd runner.Cmd) ([]byte, error) {
+		if strings.HasPrefix(cmd.String(), "docker build") {
+			started <- struct{}{}
+			<-release
+			return nil, errors.New("build stopped")
+		}
+		return nil, nil
+	}}
+	build.SetRunner(recorder)
+	deploy.SetRunner(recorder)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	t.Cleanup(func() {
+		cancel()
+		close(release)
+		if err := <-stopped; err != nil {
+			t.Errorf("Watch() error = %v", err)
+		}
+		build.SetRunner(runner.Exec{})
+		deploy.SetRunner(runner.Exec{})
+	})
+
+	app := deploy.AppConfig{ProjectPath: project}
+	app.Build.ImageName = "api:local"
+	app.Build.Dockerfile = "Dockerfile"
+	app.Build.Context = "."
+	go func() {
+		stopped <- Watch(ctx, "api", app, Config{Debounce: 50 * time.Millisecond}, false, func(c Cycle) { cycles <- c })
+	}()
+
+	// The first cycle runs without any change
+	wait(t, started)
+	release <- struct{}{}
+	if cycle := receive(t, cycles); cycle.Changed != nil {
+		t.Fatalf("first cycle changed %v", cycle.Changed)
+	}
+	return project, started, release, cycles
+}
+
+func wait(t *testing.T, started chan struct{}) {
+	t.Helper()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no build started")
+	}
+}
+
+func receive(t *testing.T, cycles chan Cycle) Cycle {
+	t.Helper()
+	select {
+	case cycle := <-cycles:
+		return cycle
+	case <-time.After(5 * time.Second):
+		t.Fatal("no cycle reported")
+		return Cycle{}
+	}
+}
+
+func idle(t *testing.T, started chan struct{}) {
+	t.Helper()
+	select {
+	case <-started:
+		t.Fatal("unexpected build started")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func touch(t *testing.T, project string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(project, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWatchDebouncesChanges(t *testing.T) {
+	project, started, release, cycles := watchLoop(t)
+
+	touch(t, project, "a.go", "b.go", "c.go")
+	wait(t, started)
+	release <- struct{}{}
+
+	cycle := receive(t, cycles)
+	if want := []string{"a.go", "b.go", "c.go"}; !reflect.DeepEqual(cycle.Changed, want) {
+		t.Errorf("Changed = %v, want %v", cycle.Changed, want)
+	}
+	if cycle.BuildErr == nil {
+		t.Error("BuildErr = nil, want the build failure")
+	}
+	idle(t, started)
+}
+
+func TestWatchQueuesChangesDuringBuild(t *testing.T) {
+	project, started, release, cycles := watchLoop(t)
+
+	touch(t, project, "a.go")
+	wait(t, started)
+
+	// Changes made while the build runs wait for it
+	touch(t, project, "b.go")
+	touch(t, project, "c.go")
+	idle(t, started)
+	release <- struct{}{}
+	if cycle := receive(t, cycles); !reflect.DeepEqual(cycle.Changed, []string{"a.go"}) {
+		t.Errorf("Changed = %v, want [a.go]", cycle.Changed)
+	}
+
+	// Then run in a single cycle
+	wait(t, started)
+	release <- struct{}{}
+	if cycle := receive(t, cycles); !reflect.DeepEqual(cycle.Changed, []string{"b.go", "c.go"}) {
+		t.Errorf("Changed = %v, want [b.go c.go]", cycle.Changed)
+	}
+	idle(t, started)
+}
@@ -0,0 +1,278 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go-cli/internal/cluster"
+	cfg "go-cli/internal/config"
+	"go-cli/internal/env"
+	"go-cli/internal/runner"
+)
+
+// tool describes how to find the version of a tool and the oldest version supported.
+type tool struct {
+	args     []string
+	min      string
+	optional bool
+	install  string
+}
+
+var tools = map[string]tool{
+	"docker":  {args: []string{"version", "--format", "{{.Client.Version}}"}, min: "20.10.0", install: "https://docs.docker.com/get-docker/"},
+	"k3d":     {args: []string{"version"}, min: "5.0.0", install: "https://k3d.io/#installation"},
+	"helm":    {args: []string{"version", "--short"}, min: "3.8.0", install: "https://helm.sh/docs/intro/install/"},
+	"kubectl": {args: []string{"version", "--client"}, min: "1.24.0", optional: true, install: "https://kubernetes.io/docs/tasks/tools/"},
+}
+
+// Tool checks that a tool is installed in a supported version.
+func Tool(name string) Check {
+	return func() Result {
+		t := tools[name]
+		result := Result{Name: name}
+
+		output, err := cmdRunner.Output(runner.Command(false, name, t.args...))
+		var missing *runner.ToolMissingError
+		switch {
+		case errors.As(err, &missing):
+			result.Status, result.Detail, result.Err = StatusFail, "not found in PATH", err
+			if t.optional {
+				result.Status, result.Err = StatusWarn, nil
+			}
+			result.Hint = "install it: " + t.install
+			return result
+		case err != nil:
+			result.Status, result.Detail, result.Err = StatusFail, "cannot get version: "+firstLine(err), err
+			return result
+		}
+
+		version := parseVersion(string(output))
+		if version == "" {
+			result.Status, result.Detail = StatusWarn, "unknown version"
+			return result
+		}
+		if compareVersions(version, t.min) < 0 {
+			result.Status, result.Detail = StatusFail, fmt.Sprintf("%s is older than %s", version, t.min)
+			if t.optional {
+				result.Status = StatusWarn
+			}
+			result.Hint = "upgrade it: " + t.install
+			return result
+		}
+		result.Status, result.Detail = StatusPass, version
+		return result
+	}
+}
+
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// parseVersion returns the first version number found in a tool's output.
+func parseVersion(output string) string {
+	return versionPattern.FindString(output)
+}
+
+// compareVersions compares dotted version numbers, missing parts counting as zero.
+func compareVersions(a string, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Daemon checks that the Docker daemon answers.
+func Daemon() Result {
+	result := Result{Name: "docker daemon"}
+	output, err := cmdRunner.Output(runner.Command(false, "docker", "info", "--format", "{{.ServerVersion}}"))
+	if err != nil {
+		result.Status, result.Detail, result.Err = StatusFail, "not reachable", err
+		result.Hint = "start Docker Desktop or the docker service, and check that your user can access it"
+		return result
+	}
+	result.Status, result.Detail = StatusPass, "server "+strings.TrimSpace(string(output))
+	return result
+}
+
+// Registry checks the state of the local registry container.
+func Registry(registry cluster.RegistryConfig) Check {
+	return func() Result {
+		return registryState(registry)
+	}
+}
+
+func registryState(registry cluster.RegistryConfig) Result {
+	result := Result{Name: "registry container"}
+	output, err := cmdRunner.Output(runner.Command(false, "docker", "inspect", "--format", "{{.State.Status}}", registry.Name))
+	var failed *runner.ToolFailedError
+	switch {
+	case errors.As(err, &failed):
+		result.Status, result.Detail = StatusWarn, fmt.Sprintf("%s does not exist", registry.Name)
+		result.Hint = "it is created by 'go-cli cluster create'"
+		return result
+	case err != nil:
+		result.Status, result.Detail, result.Err = StatusFail, "cannot inspect: "+firstLine(err), err
+		return result
+	}
+
+	state := strings.TrimSpace(string(output))
+	if state != "running" {
+		result.Status, result.Detail = StatusWarn, fmt.Sprintf("%s is %s", registry.Name, state)
+		result.Hint = "it is started by 'go-cli cluster create'"
+		return result
+	}
+	result.Status, result.Detail = StatusPass, fmt.Sprintf("%s is running", registry.Name)
+	return result
+}
+
+// RegistryPorts returns the checks that the ports of the registry and of its
+// proxies are free or held by their containers.
+func RegistryPorts(registry cluster.RegistryConfig) []Check {
+	checks := []Check{func() Result {
+		return port("registry port", registry.Port, registry.Name)
+	}}
+	for _, upstream := range registry.Upstreams() {
+		proxy := registry.Proxies[upstream]
+		checks = append(checks, func() Result {
+			return port("proxy port "+upstream, proxy.Port, registry.ProxyName(upstream))
+		})
+	}
+	return checks
+}
+
+// Ports returns the checks that the Kubernetes API port and the ports mapped
+// by the cluster are free or held by its containers.
+func Ports(config cluster.Config) []Check {
+	var checks []Check
+	if config.APIPort != 0 {
+		checks = append(checks, func() Result {
+			return port("api port", config.APIPort, config.ContainerPrefix())
+		})
+	}
+	for _, mapping := range config.Ports {
+		number, err := cluster.HostPort(mapping)
+		if err != nil {
+			continue
+		}
+		checks = append(checks, func() Result {
+			return port("port "+mapping, number, config.ContainerPrefix())
+		})
+	}
+	return checks
+}
+
+// port checks that a port is free or published by a container whose name starts with owner.
+func port(name string, number int, owner string) Result {
+	result := Result{Name: name}
+
+	// A port published by the expected container is not a conflict
+	output, _ := cmdRunner.Output(runner.Command(false, "docker", "ps", "--filter", fmt.Sprintf("publish=%d", number), "--format", "{{.Names}}"))
+	containers := strings.Fields(string(output))
+	for _, container := range containers {
+		if strings.HasPrefix(container, owner) {
+			result.Status, result.Detail = StatusPass, fmt.Sprintf("%d used by %s", number, container)
+			return result
+		}
+	}
+	if len(containers) > 0 {
+		result.Status, result.Detail = StatusFail, fmt.Sprintf("%d used by container %s", number, containers[0])
+		result.Hint = fmt.Sprintf("stop it with 'docker stop %s'", containers[0])
+		return result
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", number))
+	if err != nil {
+		result.Status, result.Detail = StatusFail, fmt.Sprintf("%d already in use", number)
+		result.Hint = fmt.Sprintf("stop the process listening on port %d", number)
+		if number == 5000 {
+			result.Hint += " (on macOS, disable the AirPlay Receiver)"
+		}
+		return result
+	}
+	listener.Close()
+	result.Status, result.Detail = StatusPass, fmt.Sprintf("%d available", number)
+	return result
+}
+
+// Config checks that the configuration file can be read and that its
+// applications and dependencies are consistent.
+func Config() Result {
+	result := Result{Name: "config"}
+
+	err := cfg.Reload()
+	var fileErr *cfg.FileError
+	if errors.As(err, &fileErr) {
+		result.Status, result.Detail, result.Err = StatusFail, firstLine(err), err
+		result.Hint = "check that " + fileErr.Path + " exists and is valid YAML"
+		return result
+	}
+	files := cfg.Files()
+	if err == nil && len(files) == 0 {
+		result.Status, result.Detail = StatusWarn, "no configuration file found"
+		result.Hint = "create $HOME/.config/cli/config.yaml or " + cfg.ProjectFile + ", or pass --config"
+		return result
+	}
+
+	if err == nil {
+		err = env.Validate()
+	}
+	var config env.Config
+	if err == nil {
+		config, err = env.ReadConfig()
+	}
+	if err != nil {
+		result.Status, result.Detail, result.Err = StatusFail, firstLine(err), err
+		result.Hint = "run 'go-cli config validate' for details, see the Configuration Reference in the README"
+		return result
+	}
+
+	path := strings.Join(files, ", ")
+	if profile := cfg.Profile(); profile != "" {
+		path += " (" + profile + " profile)"
+	}
+	result.Status = StatusPass
+	result.Detail = fmt.Sprintf("%s: %d app(s), %d dependency(ies)", path, len(config.Apps), len(config.Dependencies))
+	return result
+}
+
+// firstLine keeps checks on one line of the table, tool output is in the log file.
+func firstLine(err error) string {
+	line, _ := env.FirstLine(err.Error())
+	return line
+}
@@ -0,0 +1,156 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"go-cli/internal/runner"
+)
+
+func useRecorder(t *testing.T, replies map[string]runner.Reply) {
+	t.Helper()
+	SetRunner(&runner.Recorder{Stub: runner.StubReplies(replies)})
+	t.Cleanup(func() { SetRunner(runner.Exec{}) })
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{output: "24.0.7\n", want: "24.0.7"},
+		{output: "Docker version 24.0.7, build afdd53b", want: "24.0.7"},
+		{output: "k3d version v5.6.0\nk3s version v1.27.4-k3s1 (default)\n", want: "5.6.0"},
+		{output: "v3.13.2+g2a2fb3b\n", want: "3.13.2"},
+		{output: "Client Version: v1.28.4\nKustomize Version: v5.0.4-0.20230601165947-6ce0bf390ce3\n", want: "1.28.4"},
+		{output: "Client Version: v1.28\n", want: "1.28"},
+		{output: "development build\n", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := parseVersion(tt.output); got != tt.want {
+			t.Errorf("parseVersion(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "5.0.0", b: "5.0.0", want: 0},
+		{a: "1.28", b: "1.28.0", want: 0},
+		{a: "3.8", b: "3.8.1", want: -1},
+		{a: "1.9.0", b: "1.10.0", want: -1},
+		{a: "20.10.1", b: "20.10.0", want: 1},
+		{a: "2", b: "1.99.99", want: 1},
+	}
+
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestTool(t *testing.T) {
+	missing := &runner.ToolMissingError{Tool: "tool", Err: errors.New("executable file not found in $PATH")}
+	failed := &runner.ToolFailedError{Tool: "tool", ExitCode: 1, Stderr: "Cannot connect\n"}
+
+	tests := []struct {
+		tool       string
+		reply      runner.Reply
+		wantStatus Status
+		wantDetail string
+		wantErr    bool
+	}{
+		{tool: "helm", reply: runner.Reply{Output: "v3.13.2+g2a2fb3b\n"}, wantStatus: StatusPass, wantDetail: "3.13.2"},
+		{tool: "kubectl", reply: runner.Reply{Output: "Client Version: v1.28\n"}, wantStatus: StatusPass, wantDetail: "1.28"},
+		{tool: "helm", reply: runner.Reply{Output: "v3.7.0\n"}, wantStatus: StatusFail, wantDetail: "3.7.0 is older than 3.8.0"},
+		{tool: "kubectl", reply: runner.Reply{Output: "Client Version: v1.20.0\n"}, wantStatus: StatusWarn, wantDetail: "1.20.0 is older than 1.24.0"},
+		{tool: "k3d", reply: runner.Reply{Output: "k3d version dev\n"}, wantStatus: StatusWarn, wantDetail: "unknown version"},
+		{tool: "docker", reply: runner.Reply{Err: missing}, wantStatus: StatusFail, wantDetail: "not found in PATH", wantErr: true},
+		{tool: "kubectl", reply: runner.Reply{Err: missing}, wantStatus: StatusWarn, wantDetail: "not found in PATH"},
+		{tool: "docker", reply: runner.Reply{Err: failed}, wantStatus: StatusFail, wantDetail: "cannot get version: tool exited with code 1: Cannot connect", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %s", tt.tool, tt.wantDetail), func(t *testing.T) {
+			useRecorder(t, map[string]runner.Reply{tt.tool: tt.reply})
+
+			result := Tool(tt.tool)()
+			if result.Name != tt.tool || result.Status != tt.wantStatus || result.Detail != tt.wantDetail {
+				t.Errorf("Tool() = %+v, want %s %q", result, tt.wantStatus, tt.wantDetail)
+			}
+			if (result.Err != nil) != tt.wantErr {
+				t.Errorf("Tool() error = %v, want error %v", result.Err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPort(t *testing.T) {
+	// A port held by this test, and one free once its listener is closed
+	held, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+	heldPort := held.Addr().(*net.TCPAddr).Port
+
+	free, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	freePort := free.Addr().(*net.TCPAddr).Port
+	free.Close()
+
+	tests := []struct {
+		name       string
+		number     int
+		containers string
+		wantStatus Status
+		wantDetail string
+		wantHint   string
+	}{
+		{name: "free", number: freePort, wantStatus: StatusPass, wantDetail: fmt.Sprintf("%d available", freePort)},
+		{name: "held by a process", number: heldPort, wantStatus: StatusFail, wantDetail: fmt.Sprintf("%d already in use", heldPort), wantHint: fmt.Sprintf("stop the process listening on port %d", heldPort)},
+		{name: "held by the owner", number: heldPort, containers: "k3d-local-serverlb\n", wantStatus: StatusPass, wantDetail: fmt.Sprintf("%d used by k3d-local-serverlb", heldPort)},
+		{name: "held by another container", number: heldPort, containers: "postgres\n", wantStatus: StatusFail, wantDetail: fmt.Sprintf("%d used by container postgres", heldPort), wantHint: "stop it with 'docker stop postgres'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useRecorder(t, map[string]runner.Reply{"docker ps": {Output: tt.containers}})
+
+			result := port("api port", tt.number, "k3d-local")
+			if result.Status != tt.wantStatus || result.Detail != tt.wantDetail || result.Hint != tt.wantHint {
+				t.Errorf("port() = %+v, want %s %q hint %q", result, tt.wantStatus, tt.wantDetail, tt.wantHint)
+			}
+		})
+	}
+}
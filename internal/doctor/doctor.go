@@ -0,0 +1,169 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package doctor
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"go-cli/internal/cluster"
+	"go-cli/internal/runner"
+)
+
+var cmdRunner runner.Runner = runner.Exec{}
+
+// SetRunner replaces the runner used to query the installed tools.
+func SetRunner(r runner.Runner) {
+	cmdRunner = r
+}
+
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+// Result is the outcome of one check. Hint tells how to fix a warning or a
+// failure, and Err holds the underlying error when there is one.
+type Result struct {
+	Name   string
+	Status Status
+	Detail string
+	Hint   string
+	Err    error
+}
+
+// Check inspects one part of the local toolchain.
+type Check func() Result
+
+// All returns every check run by the doctor command.
+func All(config cluster.Config) []Check {
+	checks := []Check{
+		Tool("docker"),
+		Tool("k3d"),
+		Tool("helm"),
+		Tool("kubectl"),
+		Daemon,
+		Registry(config.Registry),
+	}
+	checks = append(checks, RegistryPorts(config.Registry)...)
+	checks = append(checks, Ports(config)...)
+	return append(checks, Config)
+}
+
+// ForCluster returns the checks run before creating the cluster.
+func ForCluster(config cluster.Config) []Check {
+	checks := []Check{
+		Tool("docker"),
+		Tool("k3d"),
+		Daemon,
+	}
+	checks = append(checks, RegistryPorts(config.Registry)...)
+	return append(checks, Ports(config)...)
+}
+
+// ForUp returns the checks run before bringing the whole environment up.
+func ForUp(config cluster.Config) []Check {
+	return append(ForCluster(config), Tool("helm"), Config)
+}
+
+// Run runs checks in order and returns their results.
+func Run(checks []Check) []Result {
+	results := make([]Result, 0, len(checks))
+	for _, check := range checks {
+		results = append(results, check())
+	}
+	return results
+}
+
+// Print writes results as a table followed by the hints of the checks that did not pass.
+func Print(w io.Writer, results []Result) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAIL")
+	for _, result := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.Name, result.Status, result.Detail)
+	}
+	tw.Flush()
+
+	var hints []string
+	for _, result := range results {
+		if result.Status != StatusPass && result.Hint != "" {
+			hints = append(hints, fmt.Sprintf("  %s: %s", result.Name, result.Hint))
+		}
+	}
+	if len(hints) > 0 {
+		fmt.Fprintf(w, "\nHints:\n%s\n", strings.Join(hints, "\n"))
+	}
+}
+
+// FailedError reports the checks that failed.
+type FailedError struct {
+	Failed []Result
+}
+
+func (e *FailedError) Error() string {
+	lines := []string{fmt.Sprintf("%d check(s) failed:", len(e.Failed))}
+	for _, result := range e.Failed {
+		line := fmt.Sprintf("  %s: %s", result.Name, result.Detail)
+		if result.Hint != "" {
+			line += " (" + result.Hint + ")"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *FailedError) Unwrap() []error {
+	var errs []error
+	for _, result := range e.Failed {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+	return errs
+}
+
+// Failed returns a *FailedError when any of results failed.
+func Failed(results []Result) error {
+	var failed []Result
+	for _, result := range results {
+		if result.Status == StatusFail {
+			failed = append(failed, result)
+		}
+	}
+	if len(failed) > 0 {
+		return &FailedError{Failed: failed}
+	}
+	return nil
+}
+
+// Preflight runs checks and returns an error wrapping a *FailedError when any of them failed.
+func Preflight(checks []Check) error {
+	if err := Failed(Run(checks)); err != nil {
+		return fmt.Errorf("preflight failed, run 'go-cli doctor' for details: %w", err)
+	}
+	return nil
+}
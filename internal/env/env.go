@@ -0,0 +1,449 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package env
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/viper"
+	"go-cli/internal/build"
+	"go-cli/internal/cluster"
+	cfg "go-cli/internal/config"
+	"go-cli/internal/deploy"
+	"go-cli/internal/graph"
+)
+
+type Config struct {
+	Cluster      cluster.Config
+	Builds       map[string]build.BuildConfig
+	Apps         map[string]deploy.AppConfig
+	Dependencies map[string]deploy.DependencyConfig
+}
+
+// ReadConfig reads the active cluster, apps and dependencies sections of the configuration.
+func ReadConfig() (Config, error) {
+	var config Config
+	var err error
+	if config.Cluster, err = cluster.ReadConfig(""); err != nil {
+		return config, err
+	}
+	if err := viper.UnmarshalKey("apps", &config.Builds); err != nil {
+		return config, cfg.Invalid("apps", err)
+	}
+	if err := viper.UnmarshalKey("apps", &config.Apps); err != nil {
+		return config, cfg.Invalid("apps", err)
+	}
+	if err := viper.UnmarshalKey("dependencies", &config.Dependencies); err != nil {
+		return config, cfg.Invalid("dependencies", err)
+	}
+	return config, nil
+}
+
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusFailed  Status = "failed"
+	StatusSkipped Status = "skipped"
+)
+
+// Step is the outcome of a single operation performed by Up, Down or Install.
+type Step struct {
+	Name     string
+	Status   Status
+	Detail   string
+	Duration time.Duration
+	Err      error
+}
+
+// PrintSummary writes steps as a table with their status, duration and error.
+// Errors spanning several lines are written in full below the table.
+func PrintSummary(w io.Writer, steps []Step) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tSTATUS\tDURATION\tDETAIL")
+	var details []Step
+	for _, step := range steps {
+		detail := step.Detail
+		if step.Err != nil {
+			var more bool
+			detail, more = FirstLine(step.Err.Error())
+			if more {
+				details = append(details, step)
+			}
+		}
+		duration := "-"
+		if step.Status != StatusSkipped {
+			duration = step.Duration.Round(100 * time.Millisecond).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", step.Name, step.Status, duration, detail)
+	}
+	tw.Flush()
+
+	for _, step := range details {
+		fmt.Fprintf(w, "\n%s: %v\n", step.Name, step.Err)
+	}
+}
+
+// FirstLine returns the first line of s and whether more lines follow.
+func FirstLine(s string) (string, bool) {
+	line, _, more := strings.Cut(s, "\n")
+	return line, more
+}
+
+// StepsError reports the steps that failed.
+type StepsError struct {
+	Failed []Step
+}
+
+func (e *StepsError) Error() string {
+	var names []string
+	for _, step := range e.Failed {
+		names = append(names, step.Name)
+	}
+	return fmt.Sprintf("%d step(s) failed: %s", len(e.Failed), strings.Join(names, ", "))
+}
+
+func (e *StepsError) Unwrap() []error {
+	var errs []error
+	for _, step := range e.Failed {
+		errs = append(errs, step.Err)
+	}
+	return errs
+}
+
+type step struct {
+	name string
+	run  func() (detail string, err error)
+}
+
+// Graph node names are prefixed with the section they come from
+const (
+	appPrefix        = "app/"
+	dependencyPrefix = "dependency/"
+)
+
+func AppNode(name string) string {
+	return appPrefix + name
+}
+
+func DependencyNode(name string) string {
+	return dependencyPrefix + name
+}
+
+// Graph builds the install graph of every app and dependency from their depends_on lists.
+// A depends_on entry names a dependency or an app, and can be prefixed with
+// "app/" or "dependency/" when both sections use the same name.
+func Graph(config Config) (*graph.Graph, error) {
+	g := graph.New()
+
+	for _, name := range sortedKeys(config.Dependencies) {
+		deps, err := resolveDependsOn(config, DependencyNode(name), config.Dependencies[name].DependsOn)
+		if err != nil {
+			return nil, err
+		}
+		g.Add(DependencyNode(name), deps...)
+	}
+
+	for _, name := range sortedKeys(config.Apps) {
+		deps, err := resolveDependsOn(config, AppNode(name), config.Apps[name].DependsOn)
+		if err != nil {
+			return nil, err
+		}
+		g.Add(AppNode(name), deps...)
+	}
+
+	if _, err := g.Sort(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func resolveDependsOn(config Config, node string, dependsOn []string) ([]string, error) {
+	var deps []string
+	for _, name := range dependsOn {
+		if app, ok := strings.CutPrefix(name, appPrefix); ok {
+			if _, exists := config.Apps[app]; !exists {
+				return nil, &cfg.InvalidError{Key: node + ".depends_on", Reason: fmt.Sprintf("references unknown app '%s'", app)}
+			}
+			deps = append(deps, name)
+			continue
+		}
+		if dependency, ok := strings.CutPrefix(name, dependencyPrefix); ok {
+			if _, exists := config.Dependencies[dependency]; !exists {
+				return nil, &cfg.InvalidError{Key: node + ".depends_on", Reason: fmt.Sprintf("references unknown dependency '%s'", dependency)}
+			}
+			deps = append(deps, name)
+			continue
+		}
+
+		_, isDependency := config.Dependencies[name]
+		_, isApp := config.Apps[name]
+		switch {
+		case isDependency && isApp:
+			return nil, &cfg.InvalidError{Key: node + ".depends_on", Reason: fmt.Sprintf("references '%s' which is both an app and a dependency, use '%s' or '%s'", name, AppNode(name), DependencyNode(name))}
+		case isDependency:
+			deps = append(deps, DependencyNode(name))
+		case isApp:
+			deps = append(deps, AppNode(name))
+		default:
+			return nil, &cfg.InvalidError{Key: node + ".depends_on", Reason: fmt.Sprintf("references unknown app or dependency '%s'", name)}
+		}
+	}
+	return deps, nil
+}
+
+// Install installs the given graph nodes, along with everything they depend on when withDeps is set.
+// Independent nodes are installed in parallel, dependent ones in topological order.
+func Install(config Config, nodes []string, withDeps bool, verbose bool, onStep func(name string)) ([]Step, error) {
+	full, err := Graph(config)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, node := range nodes {
+		if !full.Has(node) {
+			return nil, notFound(node)
+		}
+	}
+
+	g := graph.New()
+	if withDeps {
+		if g, err = full.Closure(nodes...); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, node := range nodes {
+			g.Add(node)
+		}
+	}
+
+	return installGraph(config, g, verbose, onStep)
+}
+
+func notFound(node string) error {
+	if name, ok := strings.CutPrefix(node, dependencyPrefix); ok {
+		return &cfg.NotFoundError{Kind: "dependency", Name: name}
+	}
+	return &cfg.NotFoundError{Kind: "application", Name: strings.TrimPrefix(node, appPrefix)}
+}
+
+func installGraph(config Config, g *graph.Graph, verbose bool, onStep func(name string)) ([]Step, error) {
+	var mu sync.Mutex
+	durations := make(map[string]time.Duration)
+
+	outcomes, err := g.Run(0, func(node string) error {
+		if onStep != nil {
+			onStep(stepName(node))
+		}
+
+		start := time.Now()
+		err := installNode(config, node, verbose)
+
+		mu.Lock()
+		durations[node] = time.Since(start)
+		mu.Unlock()
+		return err
+	})
+
+	var results []Step
+	for _, outcome := range outcomes {
+		result := Step{Name: stepName(outcome.Node), Status: StatusOK, Duration: durations[outcome.Node], Err: outcome.Err}
+		switch {
+		case outcome.Skipped:
+			result.Status = StatusSkipped
+			result.Detail = outcome.Reason
+		case outcome.Err != nil:
+			result.Status = StatusFailed
+		}
+		results = append(results, result)
+	}
+	return results, err
+}
+
+func installNode(config Config, node string, verbose bool) error {
+	if name, ok := strings.CutPrefix(node, dependencyPrefix); ok {
+		return deploy.InstallDependency(name, config.Dependencies[name], verbose)
+	}
+	name := strings.TrimPrefix(node, appPrefix)
+	return deploy.InstallApp(config.Apps[name], name, verbose)
+}
+
+func stepName(node string) string {
+	if name, ok := strings.CutPrefix(node, dependencyPrefix); ok {
+		return "install dependency " + name
+	}
+	return "install app " + strings.TrimPrefix(node, appPrefix)
+}
+
+// Up creates the cluster if missing, configures Helm repositories, builds
+// every application, then installs apps and dependencies following their
+// depends_on graph. It stops at the first failure and reports the remaining
+// steps as skipped.
+func Up(config Config, verbose bool, onStep func(name string)) ([]Step, error) {
+	g, err := Graph(config)
+	if err != nil {
+		return nil, err
+	}
+
+	steps := []step{
+		{"create cluster", func() (string, error) {
+			exists, err := cluster.Exists(config.Cluster.Name)
+			if err != nil {
+				return "", err
+			}
+			if exists {
+				return "already exists", nil
+			}
+			return "", cluster.Create(config.Cluster, verbose)
+		}},
+		{"check kube context", func() (string, error) {
+			return deploy.KubeContext()
+		}},
+		{"configure helm repositories", func() (string, error) {
+			return "", deploy.ConfigureHelmRepos(verbose)
+		}},
+	}
+
+	for _, name := range sortedKeys(config.Apps) {
+		appName := name
+		if buildConfig, ok := config.Builds[appName]; ok && buildConfig.Build.ImageName != "" {
+			steps = append(steps, step{"build app " + appName, func() (string, error) {
+				return "", build.Build(buildConfig, verbose)
+			}})
+		}
+	}
+
+	results, err := execute(steps, true, onStep)
+	if err != nil {
+		order, _ := g.Sort()
+		for _, node := range order {
+			results = append(results, Step{Name: stepName(node), Status: StatusSkipped})
+		}
+		return results, err
+	}
+
+	installs, err := installGraph(config, g, verbose, onStep)
+	return append(results, installs...), err
+}
+
+// Down uninstalls every application and dependency in reverse dependency
+// order, then deletes the cluster. Failures are reported but do not stop the
+// teardown, and the uninstalls are skipped when the cluster is already gone.
+func Down(config Config, verbose bool, removeRegistry bool, onStep func(name string)) ([]Step, error) {
+	g, err := Graph(config)
+	if err != nil {
+		return nil, err
+	}
+	order, _ := g.Sort()
+
+	exists, err := cluster.Exists(config.Cluster.Name)
+	if err != nil {
+		return nil, err
+	}
+	// Dry runs print the whole teardown
+	exists = exists || cluster.DryRun()
+
+	var steps []step
+	var results []Step
+	for i := len(order) - 1; i >= 0; i-- {
+		node := order[i]
+		if !exists {
+			results = append(results, Step{Name: uninstallName(node), Status: StatusSkipped, Detail: "cluster not found"})
+			continue
+		}
+		if name, ok := strings.CutPrefix(node, dependencyPrefix); ok {
+			depConfig := config.Dependencies[name]
+			steps = append(steps, step{uninstallName(node), func() (string, error) {
+				return "", deploy.UninstallDependency(name, depConfig, verbose)
+			}})
+			continue
+		}
+		name := strings.TrimPrefix(node, appPrefix)
+		appConfig := config.Apps[name]
+		steps = append(steps, step{uninstallName(node), func() (string, error) {
+			return "", deploy.UninstallApp(appConfig, name, verbose)
+		}})
+	}
+
+	steps = append(steps, step{"delete cluster", func() (string, error) {
+		if !exists {
+			return "not found", nil
+		}
+		_, err := cluster.Delete(config.Cluster, verbose, removeRegistry)
+		return "", err
+	}})
+
+	executed, err := execute(steps, false, onStep)
+	return append(results, executed...), err
+}
+
+func uninstallName(node string) string {
+	if name, ok := strings.CutPrefix(node, dependencyPrefix); ok {
+		return "uninstall dependency " + name
+	}
+	return "uninstall app " + strings.TrimPrefix(node, appPrefix)
+}
+
+func execute(steps []step, failFast bool, onStep func(name string)) ([]Step, error) {
+	var results []Step
+	var failed []Step
+
+	for _, s := range steps {
+		if failFast && len(failed) > 0 {
+			results = append(results, Step{Name: s.name, Status: StatusSkipped})
+			continue
+		}
+
+		if onStep != nil {
+			onStep(s.name)
+		}
+
+		start := time.Now()
+		detail, err := s.run()
+		result := Step{Name: s.name, Status: StatusOK, Detail: detail, Duration: time.Since(start), Err: err}
+		if err != nil {
+			result.Status = StatusFailed
+			failed = append(failed, result)
+		}
+		results = append(results, result)
+	}
+
+	if len(failed) > 0 {
+		return results, &StepsError{Failed: failed}
+	}
+	return results, nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
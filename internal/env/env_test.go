@@ -0,0 +1,183 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package env
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go-cli/internal/cluster"
+	cfg "go-cli/internal/config"
+	"go-cli/internal/deploy"
+	"go-cli/internal/graph"
+	"go-cli/internal/runner"
+)
+
+func TestGraph(t *testing.T) {
+	tests := []struct {
+		name         string
+		apps         map[string][]string
+		dependencies map[string][]string
+		want         []string
+		wantKey      string
+		wantCycle    bool
+	}{
+		{
+			name:         "bare names",
+			apps:         map[string][]string{"api": {"postgresql", "auth"}, "auth": {"postgresql"}},
+			dependencies: map[string][]string{"postgresql": nil},
+			want:         []string{"dependency/postgresql", "app/auth", "app/api"},
+		},
+		{
+			name:         "prefixed names",
+			apps:         map[string][]string{"api": {"dependency/redis", "app/redis"}, "redis": nil},
+			dependencies: map[string][]string{"redis": nil},
+			want:         []string{"dependency/redis", "app/redis", "app/api"},
+		},
+		{
+			name:         "ambiguous name",
+			apps:         map[string][]string{"api": {"redis"}, "redis": nil},
+			dependencies: map[string][]string{"redis": nil},
+			wantKey:      "app/api.depends_on",
+		},
+		{
+			name:    "unknown name",
+			apps:    map[string][]string{"api": {"postgres"}},
+			wantKey: "app/api.depends_on",
+		},
+		{
+			name:         "unknown prefixed app",
+			apps:         map[string][]string{"api": nil},
+			dependencies: map[string][]string{"redis": {"app/apu"}},
+			wantKey:      "dependency/redis.depends_on",
+		},
+		{
+			name:    "unknown prefixed dependency",
+			apps:    map[string][]string{"api": {"dependency/postgresql"}},
+			wantKey: "app/api.depends_on",
+		},
+		{
+			name:      "cycle",
+			apps:      map[string][]string{"api": {"auth"}, "auth": {"api"}},
+			wantCycle: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{Apps: map[string]deploy.AppConfig{}, Dependencies: map[string]deploy.DependencyConfig{}}
+			for name, dependsOn := range tt.apps {
+				config.Apps[name] = deploy.AppConfig{DependsOn: dependsOn}
+			}
+			for name, dependsOn := range tt.dependencies {
+				config.Dependencies[name] = deploy.DependencyConfig{DependsOn: dependsOn}
+			}
+
+			g, err := Graph(config)
+
+			var invalid *cfg.InvalidError
+			if errors.As(err, &invalid) != (tt.wantKey != "") || (invalid != nil && invalid.Key != tt.wantKey) {
+				t.Fatalf("Graph() error = %v, want an invalid %s", err, tt.wantKey)
+			}
+			var cycle *graph.CycleError
+			if errors.As(err, &cycle) != tt.wantCycle {
+				t.Fatalf("Graph() error = %v, want cycle %v", err, tt.wantCycle)
+			}
+			if err != nil {
+				return
+			}
+			if got, _ := g.Sort(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Graph().Sort() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDown(t *testing.T) {
+	config := Config{
+		Cluster:      cluster.DefaultConfig(),
+		Apps:         map[string]deploy.AppConfig{"api": {DependsOn: []string{"redis"}, Install: deploy.InstallConfig{Namespace: "app"}}},
+		Dependencies: map[string]deploy.DependencyConfig{"redis": {Namespace: "data"}},
+	}
+
+	tests := []struct {
+		name      string
+		clusters  string
+		wantSteps []Step
+		wantLines []string
+	}{
+		{
+			name:     "running cluster",
+			clusters: `[{"name":"local"}]`,
+			wantSteps: []Step{
+				{Name: "uninstall app api", Status: StatusOK},
+				{Name: "uninstall dependency redis", Status: StatusOK},
+				{Name: "delete cluster", Status: StatusOK},
+			},
+			wantLines: []string{
+				"k3d cluster list -o json",
+				"helm uninstall api --namespace app --kube-context k3d-local",
+				"helm uninstall redis --namespace data --kube-context k3d-local",
+				"k3d cluster delete local",
+				"k3d cluster list -o json",
+			},
+		},
+		{
+			name:     "cluster already gone",
+			clusters: `[]`,
+			wantSteps: []Step{
+				{Name: "uninstall app api", Status: StatusSkipped, Detail: "cluster not found"},
+				{Name: "uninstall dependency redis", Status: StatusSkipped, Detail: "cluster not found"},
+				{Name: "delete cluster", Status: StatusOK, Detail: "not found"},
+			},
+			wantLines: []string{"k3d cluster list -o json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+			recorder := &runner.Recorder{Stub: runner.StubPrefixes(map[string]string{"k3d cluster list": tt.clusters})}
+			cluster.SetRunner(recorder)
+			deploy.SetRunner(recorder)
+			deploy.SetKubeContext("k3d-local")
+			t.Cleanup(func() {
+				cluster.SetRunner(runner.Exec{})
+				deploy.SetRunner(runner.Exec{})
+				deploy.SetKubeContext("")
+			})
+
+			steps, err := Down(config, false, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range steps {
+				steps[i].Duration = 0
+			}
+			if !reflect.DeepEqual(steps, tt.wantSteps) {
+				t.Errorf("Down() = %+v, want %+v", steps, tt.wantSteps)
+			}
+			if got := recorder.Lines(); !reflect.DeepEqual(got, tt.wantLines) {
+				t.Errorf("Down() ran\n%q\nwant\n%q", got, tt.wantLines)
+			}
+		})
+	}
+}
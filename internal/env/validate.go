@@ -0,0 +1,382 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"go-cli/internal/build"
+	"go-cli/internal/cluster"
+	cfg "go-cli/internal/config"
+	"go-cli/internal/deploy"
+	"go-cli/internal/dev"
+	"go-cli/internal/helm"
+)
+
+// fileConfig lists every key read from the configuration files.
+type fileConfig struct {
+	Cluster             cluster.Config                     `mapstructure:"cluster"`
+	Clusters            map[string]cluster.Config          `mapstructure:"clusters"`
+	Registry            cluster.RegistryConfig             `mapstructure:"registry"`
+	Apps                map[string]appConfig               `mapstructure:"apps"`
+	Dependencies        map[string]deploy.DependencyConfig `mapstructure:"dependencies"`
+	HelmRepositories    map[string]helm.RepoConfig         `mapstructure:"helm_repositories"`
+	HelmRepositoriesTTL time.Duration                      `mapstructure:"helm_repositories_ttl"`
+	AllowedKubeContexts []string                           `mapstructure:"allowed_kube_contexts"`
+}
+
+// appConfig holds the keys of an app read by build, install and dev.
+type appConfig struct {
+	deploy.AppConfig `mapstructure:",squash"`
+	Dev              dev.Config `mapstructure:"dev"`
+}
+
+// schema describes the keys accepted at some point of the configuration.
+type schema struct {
+	kind   reflect.Kind
+	fields map[string]*schema
+	elem   *schema
+}
+
+func schemaOf(t reflect.Type) *schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	s := &schema{kind: t.Kind()}
+	switch t.Kind() {
+	case reflect.Struct:
+		s.fields = map[string]*schema{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, options, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+			if name == "-" || !field.IsExported() {
+				continue
+			}
+			if strings.Contains(options, "squash") {
+				for k, v := range schemaOf(field.Type).fields {
+					s.fields[k] = v
+				}
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			s.fields[name] = schemaOf(field.Type)
+		}
+	case reflect.Map, reflect.Slice:
+		s.elem = schemaOf(t.Elem())
+	}
+	return s
+}
+
+// rootSchema accepts profiles holding any key of the configuration itself.
+func rootSchema() *schema {
+	root := schemaOf(reflect.TypeOf(fileConfig{}))
+	root.fields["profiles"] = &schema{kind: reflect.Map, elem: root}
+	return root
+}
+
+type validator struct {
+	problems []cfg.Problem
+}
+
+func (v *validator) add(key string, format string, args ...any) {
+	position, _ := cfg.PositionOf(key)
+	problem := cfg.Problem{Key: key, Message: fmt.Sprintf(format, args...), Position: position}
+
+	// Keys of the applied profile are also found merged in the configuration
+	if profile := cfg.Profile(); profile != "" {
+		prefix := "profiles." + strings.ToLower(profile) + "."
+		for _, existing := range v.problems {
+			if existing.Position == position && existing.Message == problem.Message &&
+				strings.TrimPrefix(strings.ToLower(existing.Key), prefix) == strings.TrimPrefix(strings.ToLower(key), prefix) {
+				return
+			}
+		}
+	}
+	v.problems = append(v.problems, problem)
+}
+
+// addErr records an error met while reading the configuration, at the key
+// it reports when it has one.
+func (v *validator) addErr(err error) {
+	var invalid *cfg.InvalidError
+	if errors.As(err, &invalid) {
+		message := invalid.Reason
+		if invalid.Err != nil {
+			message += ": " + invalid.Err.Error()
+		}
+		// Graph nodes name the section of their entry
+		key := invalid.Key
+		if strings.HasPrefix(key, appPrefix) {
+			key = "apps." + strings.TrimPrefix(key, appPrefix)
+		} else if strings.HasPrefix(key, dependencyPrefix) {
+			key = "dependencies." + strings.TrimPrefix(key, dependencyPrefix)
+		}
+		v.add(key, "%s", message)
+		return
+	}
+	v.problems = append(v.problems, cfg.Problem{Message: err.Error()})
+}
+
+// Validate checks the loaded configuration: unknown keys, values of the
+// wrong shape, required fields of apps and dependencies, and the files and
+// directories they point at. Problems are reported with their location.
+func Validate() error {
+	doc := cfg.Document()
+	if doc == nil {
+		return nil
+	}
+
+	v := &validator{}
+	v.keys(doc, "", rootSchema())
+
+	// Values of the wrong shape already explain why decoding fails
+	config, err := ReadConfig()
+	if err != nil {
+		if len(v.problems) == 0 {
+			v.addErr(err)
+		}
+	} else {
+		if _, err := Graph(config); err != nil {
+			v.addErr(err)
+		}
+		v.apps(config)
+		v.dependencies(config)
+	}
+
+	if len(v.problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		a, b := v.problems[i].Position, v.problems[j].Position
+		if a.File != b.File {
+			return a.File != "" && (b.File == "" || a.File < b.File)
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return &cfg.ValidationError{Problems: v.problems}
+}
+
+// keys checks value, found at key, against s.
+func (v *validator) keys(value any, key string, s *schema) {
+	if value == nil {
+		return
+	}
+	switch s.kind {
+	case reflect.Interface:
+		return
+	case reflect.Struct, reflect.Map:
+		m, ok := value.(map[string]any)
+		if !ok {
+			v.add(key, "must be a map")
+			return
+		}
+		for _, k := range sortedKeys(m) {
+			child := joinKey(key, k)
+			if s.kind == reflect.Map {
+				v.keys(m[k], child, s.elem)
+				continue
+			}
+			field, ok := s.fields[strings.ToLower(k)]
+			if !ok {
+				v.add(child, "is not a known key%s", suggest(k, s.fields))
+				continue
+			}
+			v.keys(m[k], child, field)
+		}
+	case reflect.Slice:
+		// A single value is accepted as a list of one
+		if list, ok := value.([]any); ok {
+			for i, item := range list {
+				v.keys(item, fmt.Sprintf("%s.%d", key, i), s.elem)
+			}
+		}
+	default:
+		switch value.(type) {
+		case map[string]any, []any:
+			v.add(key, "must be a single value")
+		}
+	}
+}
+
+func joinKey(key string, child string) string {
+	if key == "" {
+		return child
+	}
+	return key + "." + child
+}
+
+// suggest names the known key closest to a mistyped one.
+func suggest(key string, fields map[string]*schema) string {
+	best, bestDistance := "", 3
+	for _, name := range sortedKeys(fields) {
+		if d := distance(strings.ToLower(key), name); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean '%s'?)", best)
+}
+
+// distance is the Levenshtein distance between a and b.
+func distance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func (v *validator) apps(config Config) {
+	for _, name := range sortedKeys(config.Apps) {
+		key := "apps." + name
+		app := config.Apps[name]
+		if app.ProjectPath == "" {
+			v.add(key+".project_path", "is required")
+			continue
+		}
+		projectDir, ok := v.dir(key+".project_path", app.ProjectPath, "")
+		if !ok {
+			continue
+		}
+
+		if cfg.Raw(key+".build") != nil {
+			v.build(key+".build", app.Build, projectDir)
+		}
+		if cfg.Raw(key+".install") != nil {
+			v.install(key+".install", app.Install, projectDir)
+		}
+	}
+}
+
+func (v *validator) build(key string, details build.BuildDetails, projectDir string) {
+	v.required(key+".image_name", details.ImageName)
+	if v.required(key+".dockerfile", details.Dockerfile) && v.required(key+".context", details.Context) {
+		if contextDir, ok := v.dir(key+".context", details.Context, projectDir); ok {
+			v.file(key+".dockerfile", details.Dockerfile, contextDir)
+		}
+	}
+	if tag := details.Tag; tag != "" && tag != build.TagGitSHA && tag != build.TagDigest {
+		v.add(key+".tag", "has unknown strategy '%s' (expected '%s' or '%s')", tag, build.TagGitSHA, build.TagDigest)
+	}
+	if mode := details.Publish.Mode; mode != "" && mode != build.PublishRegistry && mode != build.PublishK3d {
+		v.add(key+".publish.mode", "has unknown value '%s' (expected '%s' or '%s')", mode, build.PublishRegistry, build.PublishK3d)
+	}
+}
+
+func (v *validator) install(key string, install deploy.InstallConfig, projectDir string) {
+	v.required(key+".namespace", install.Namespace)
+	if v.required(key+".chart_path", install.ChartPath) {
+		v.exists(key+".chart_path", install.ChartPath, projectDir)
+	}
+	v.valuesFiles(key, install.ValuesFile, install.ValuesFiles, projectDir)
+}
+
+func (v *validator) dependencies(config Config) {
+	for _, name := range sortedKeys(config.Dependencies) {
+		key := "dependencies." + name
+		dependency := config.Dependencies[name]
+		v.required(key+".chart_name", dependency.ChartName)
+		v.valuesFiles(key, dependency.ValuesFile, dependency.ValuesFiles, "")
+	}
+}
+
+func (v *validator) valuesFiles(key string, file string, files []string, dir string) {
+	if file != "" {
+		v.file(key+".values_file", file, dir)
+	}
+	for i, file := range files {
+		v.file(fmt.Sprintf("%s.values_files.%d", key, i), file, dir)
+	}
+}
+
+func (v *validator) required(key string, value string) bool {
+	if value == "" {
+		v.add(key, "is required")
+		return false
+	}
+	return true
+}
+
+// resolve resolves a relative path against dir, or the working directory when
+// dir is empty.
+func resolve(p string, dir string) string {
+	if !filepath.IsAbs(p) && dir != "" {
+		p = filepath.Join(dir, p)
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	return abs
+}
+
+func (v *validator) exists(key string, p string, dir string) (os.FileInfo, string, bool) {
+	resolved := resolve(p, dir)
+	info, err := os.Stat(resolved)
+	if err != nil {
+		v.add(key, "points at '%s', which does not exist", resolved)
+		return nil, resolved, false
+	}
+	return info, resolved, true
+}
+
+func (v *validator) dir(key string, p string, dir string) (string, bool) {
+	info, resolved, ok := v.exists(key, p, dir)
+	if ok && !info.IsDir() {
+		v.add(key, "points at '%s', which is not a directory", resolved)
+		return resolved, false
+	}
+	return resolved, ok
+}
+
+func (v *validator) file(key string, p string, dir string) {
+	info, resolved, ok := v.exists(key, p, dir)
+	if ok && info.IsDir() {
+		v.add(key, "points at '%s', which is a directory", resolved)
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package env
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	cfg "go-cli/internal/config"
+
+	"github.com/spf13/viper"
+)
+
+// loadConfig writes content to a configuration file in a directory holding
+// the given files and loads it from there.
+func loadConfig(t *testing.T, content string, profile string, files ...string) string {
+	t.Helper()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range append(files, "config.yaml") {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		data := ""
+		if file == "config.yaml" {
+			data = content
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Chdir(dir)
+	viper.Reset()
+	viper.SetConfigFile(filepath.Join(dir, "config.yaml"))
+	t.Cleanup(func() {
+		viper.Reset()
+		cfg.Load("")
+	})
+	if err := cfg.Load(profile); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		profile string
+		files   []string
+		want    []string
+	}{
+		{
+			name: "valid configuration",
+			config: `cluster:
+  name: local
+apps:
+  api:
+    project_path: api
+    build:
+      image_name: api
+      context: .
+      dockerfile: Dockerfile
+    install:
+      namespace: app
+      chart_path: chart/Chart.yaml
+      values_files: [values.yaml]
+dependencies:
+  redis:
+    chart_name: bitnami/redis
+    values_file: values/redis.yaml
+`,
+			files: []string{"api/Dockerfile", "api/chart/Chart.yaml", "api/values.yaml", "values/redis.yaml"},
+		},
+		{
+			name:   "unknown keys",
+			config: "cluster:\n  nam: local\n  agents: 1\nregistyr:\n  port: 5000\nfoo: bar\n",
+			want: []string{
+				"{dir}/config.yaml:2:3: cluster.nam is not a known key (did you mean 'name'?)",
+				"{dir}/config.yaml:4:1: registyr is not a known key (did you mean 'registry'?)",
+				"{dir}/config.yaml:6:1: foo is not a known key",
+			},
+		},
+		{
+			name: "values of the wrong shape",
+			config: `cluster:
+  name: [local]
+apps: api
+`,
+			want: []string{
+				"{dir}/config.yaml:2:3: cluster.name must be a single value",
+				"{dir}/config.yaml:3:1: apps must be a map",
+			},
+		},
+		{
+			name: "missing fields and files",
+			config: `dependencies:
+  redis:
+    values_files: [values.yaml, missing.yaml]
+apps:
+  web:
+    install:
+      namespace: web
+  api:
+    project_path: api
+    build:
+      image_name: api
+      context: .
+      dockerfile: Dockerfile
+      tag: latest
+    install:
+      namespace: app
+      chart_path: chart
+`,
+			files: []string{"values.yaml", "api/.keep"},
+			want: []string{
+				"{dir}/config.yaml:2:3: dependencies.redis.chart_name is required",
+				"{dir}/config.yaml:3:33: dependencies.redis.values_files.1 points at '{dir}/missing.yaml', which does not exist",
+				"{dir}/config.yaml:5:3: apps.web.project_path is required",
+				"{dir}/config.yaml:13:7: apps.api.build.dockerfile points at '{dir}/api/Dockerfile', which does not exist",
+				"{dir}/config.yaml:14:7: apps.api.build.tag has unknown strategy 'latest' (expected 'git-sha' or 'digest')",
+				"{dir}/config.yaml:17:7: apps.api.install.chart_path points at '{dir}/api/chart', which does not exist",
+			},
+		},
+		{
+			name: "unknown dependency",
+			config: `apps:
+  api:
+    project_path: .
+    depends_on: [postgres]
+`,
+			want: []string{"{dir}/config.yaml:4:5: apps.api.depends_on references unknown app or dependency 'postgres'"},
+		},
+		{
+			name: "problem of the applied profile reported once",
+			config: `cluster:
+  name: local
+profiles:
+  ci:
+    cluster:
+      agnets: 0
+`,
+			profile: "ci",
+			want: []string{
+				"{dir}/config.yaml:6:7: cluster.agnets is not a known key (did you mean 'agents'?)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := loadConfig(t, tt.config, tt.profile, tt.files...)
+
+			err := Validate()
+			var validation *cfg.ValidationError
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &validation) {
+				t.Fatalf("Validate() error = %v, want a ValidationError", err)
+			}
+			var got []string
+			for _, problem := range validation.Problems {
+				got = append(got, problem.String())
+			}
+			var want []string
+			for _, line := range tt.want {
+				want = append(want, replaceDir(line, dir))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("problems =\n  %v\nwant\n  %v", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateWithoutConfiguration(t *testing.T) {
+	t.Chdir(t.TempDir())
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	if err := cfg.Load(""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(); err != nil {
+		t.Errorf("Validate() error = %v, want nil", err)
+	}
+}
+
+func replaceDir(s string, dir string) string {
+	return strings.ReplaceAll(s, "{dir}", dir)
+}
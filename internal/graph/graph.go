@@ -0,0 +1,296 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Graph is a directed acyclic graph of named nodes and the nodes they depend on.
+type Graph struct {
+	deps  map[string][]string
+	nodes []string
+}
+
+func New() *Graph {
+	return &Graph{deps: make(map[string][]string)}
+}
+
+// Add registers node with its dependencies. Adding a node twice merges its dependencies.
+func (g *Graph) Add(node string, deps ...string) {
+	if _, exists := g.deps[node]; !exists {
+		g.nodes = append(g.nodes, node)
+		g.deps[node] = nil
+	}
+	g.deps[node] = append(g.deps[node], deps...)
+}
+
+func (g *Graph) Has(node string) bool {
+	_, exists := g.deps[node]
+	return exists
+}
+
+// Nodes returns the nodes in the order they were added.
+func (g *Graph) Nodes() []string {
+	return append([]string(nil), g.nodes...)
+}
+
+// Deps returns the direct dependencies of node.
+func (g *Graph) Deps(node string) []string {
+	return append([]string(nil), g.deps[node]...)
+}
+
+// CycleError reports a dependency cycle, listing the nodes along it.
+type CycleError struct {
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("dependency cycle detected: %s", strings.Join(e.Path, " -> "))
+}
+
+// Sort returns the nodes in topological order, dependencies first.
+func (g *Graph) Sort() ([]string, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int)
+	var order []string
+	var stack []string
+
+	var visit func(node string) error
+	visit = func(node string) error {
+		switch state[node] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for i, n := range stack {
+				if n == node {
+					start = i
+				}
+			}
+			path := append(append([]string(nil), stack[start:]...), node)
+			return &CycleError{Path: path}
+		}
+
+		if !g.Has(node) {
+			return fmt.Errorf("unknown dependency '%s' of '%s'", node, stack[len(stack)-1])
+		}
+
+		state[node] = visiting
+		stack = append(stack, node)
+		for _, dep := range g.deps[node] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[node] = visited
+		order = append(order, node)
+		return nil
+	}
+
+	for _, node := range g.nodes {
+		if err := visit(node); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Closure returns the subgraph made of nodes and everything they transitively depend on.
+func (g *Graph) Closure(nodes ...string) (*Graph, error) {
+	sub := New()
+
+	var visit func(node string) error
+	visit = func(node string) error {
+		if sub.Has(node) {
+			return nil
+		}
+		if !g.Has(node) {
+			return fmt.Errorf("unknown node '%s'", node)
+		}
+		sub.Add(node, g.deps[node]...)
+		for _, dep := range g.deps[node] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, node := range nodes {
+		if err := visit(node); err != nil {
+			return nil, err
+		}
+	}
+	return sub, nil
+}
+
+// Outcome is what happened to a node during Run.
+type Outcome struct {
+	Node    string
+	Err     error
+	Skipped bool
+	Reason  string
+}
+
+// RunError reports the nodes that failed and the nodes that were never started because of them.
+type RunError struct {
+	Failed  map[string]error
+	Blocked map[string]string
+}
+
+func (e *RunError) Error() string {
+	var failed []string
+	for node := range e.Failed {
+		failed = append(failed, node)
+	}
+	sort.Strings(failed)
+
+	var parts []string
+	for _, node := range failed {
+		parts = append(parts, fmt.Sprintf("'%s' failed: %v", node, e.Failed[node]))
+	}
+
+	if len(e.Blocked) > 0 {
+		var blocked []string
+		for node := range e.Blocked {
+			blocked = append(blocked, node)
+		}
+		sort.Strings(blocked)
+		parts = append(parts, fmt.Sprintf("not started: %s", strings.Join(blocked, ", ")))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+func (e *RunError) Unwrap() []error {
+	var errs []error
+	for _, err := range e.Failed {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+type result struct {
+	node string
+	err  error
+}
+
+// Run calls fn for every node once all of its dependencies succeeded, running
+// up to jobs independent nodes concurrently (no limit when jobs <= 0).
+// After the first failure no new node is started; running nodes are awaited
+// and every node left over is reported as skipped.
+// Outcomes are returned in completion order followed by the skipped nodes.
+func (g *Graph) Run(jobs int, fn func(node string) error) ([]Outcome, error) {
+	order, err := g.Sort()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make(map[string]int)
+	dependents := make(map[string][]string)
+	var ready []string
+	for _, node := range order {
+		pending[node] = len(g.deps[node])
+		for _, dep := range g.deps[node] {
+			dependents[dep] = append(dependents[dep], node)
+		}
+		if pending[node] == 0 {
+			ready = append(ready, node)
+		}
+	}
+
+	results := make(chan result)
+	finished := make(map[string]error)
+	var outcomes []Outcome
+	var firstFailure string
+	running := 0
+
+	for {
+		for firstFailure == "" && len(ready) > 0 && (jobs <= 0 || running < jobs) {
+			node := ready[0]
+			ready = ready[1:]
+			running++
+			go func() {
+				results <- result{node: node, err: fn(node)}
+			}()
+		}
+
+		if running == 0 {
+			break
+		}
+
+		r := <-results
+		running--
+		finished[r.node] = r.err
+		outcomes = append(outcomes, Outcome{Node: r.node, Err: r.err})
+
+		if r.err != nil {
+			if firstFailure == "" {
+				firstFailure = r.node
+			}
+			continue
+		}
+		for _, dependent := range dependents[r.node] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if firstFailure == "" {
+		return outcomes, nil
+	}
+
+	runErr := &RunError{Failed: make(map[string]error), Blocked: make(map[string]string)}
+	for node, err := range finished {
+		if err != nil {
+			runErr.Failed[node] = err
+		}
+	}
+
+	for _, node := range order {
+		if _, done := finished[node]; done {
+			continue
+		}
+		reason := fmt.Sprintf("not started after '%s' failed", firstFailure)
+		for _, dep := range g.deps[node] {
+			if err, done := finished[dep]; !done || err != nil {
+				reason = fmt.Sprintf("blocked by '%s'", dep)
+				break
+			}
+		}
+		runErr.Blocked[node] = reason
+		outcomes = append(outcomes, Outcome{Node: node, Skipped: true, Reason: reason})
+	}
+
+	return outcomes, runErr
+}
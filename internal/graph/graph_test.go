@@ -0,0 +1,221 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package graph
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// build returns a graph of nodes added in order, each with its dependencies.
+func build(nodes [][]string) *Graph {
+	g := New()
+	for _, node := range nodes {
+		g.Add(node[0], node[1:]...)
+	}
+	return g
+}
+
+func TestSort(t *testing.T) {
+	tests := []struct {
+		name      string
+		nodes     [][]string
+		want      []string
+		wantCycle []string
+		wantErr   bool
+	}{
+		{
+			name:  "independent nodes keep their order",
+			nodes: [][]string{{"c"}, {"a"}, {"b"}},
+			want:  []string{"c", "a", "b"},
+		},
+		{
+			name:  "dependencies first",
+			nodes: [][]string{{"api", "db", "cache"}, {"cache"}, {"db"}},
+			want:  []string{"db", "cache", "api"},
+		},
+		{
+			name:  "diamond",
+			nodes: [][]string{{"ui", "api", "auth"}, {"api", "db"}, {"auth", "db"}, {"db"}},
+			want:  []string{"db", "api", "auth", "ui"},
+		},
+		{
+			name:  "dependencies added twice are merged",
+			nodes: [][]string{{"api", "db"}, {"api", "cache"}, {"db"}, {"cache"}},
+			want:  []string{"db", "cache", "api"},
+		},
+		{
+			name:      "cycle",
+			nodes:     [][]string{{"a", "b"}, {"b", "c"}, {"c", "a"}},
+			wantCycle: []string{"a", "b", "c", "a"},
+			wantErr:   true,
+		},
+		{
+			name:      "self dependency",
+			nodes:     [][]string{{"a", "a"}},
+			wantCycle: []string{"a", "a"},
+			wantErr:   true,
+		},
+		{
+			name:    "unknown dependency",
+			nodes:   [][]string{{"api", "db"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := build(tt.nodes).Sort()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Sort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sort() = %v, want %v", got, tt.want)
+			}
+			var cycle *CycleError
+			if errors.As(err, &cycle) != (tt.wantCycle != nil) {
+				t.Fatalf("Sort() error = %v, want cycle %v", err, tt.wantCycle)
+			}
+			if cycle != nil && !reflect.DeepEqual(cycle.Path, tt.wantCycle) {
+				t.Errorf("CycleError.Path = %v, want %v", cycle.Path, tt.wantCycle)
+			}
+		})
+	}
+}
+
+func TestClosure(t *testing.T) {
+	g := build([][]string{{"ui", "api"}, {"api", "db"}, {"db"}, {"worker", "queue"}, {"queue"}})
+
+	tests := []struct {
+		nodes []string
+		want  []string
+	}{
+		{nodes: []string{"db"}, want: []string{"db"}},
+		{nodes: []string{"ui"}, want: []string{"ui", "api", "db"}},
+		{nodes: []string{"api", "worker"}, want: []string{"api", "db", "worker", "queue"}},
+	}
+	for _, tt := range tests {
+		sub, err := g.Closure(tt.nodes...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sub.Nodes(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Closure(%v) = %v, want %v", tt.nodes, got, tt.want)
+		}
+	}
+
+	if _, err := g.Closure("missing"); err == nil {
+		t.Error("Closure(missing) succeeded")
+	}
+}
+
+func TestRunOrder(t *testing.T) {
+	g := build([][]string{{"ui", "api", "auth"}, {"api", "db"}, {"auth", "db"}, {"db"}, {"cache"}})
+
+	for _, jobs := range []int{0, 1, 2} {
+		var mu sync.Mutex
+		done := map[string]bool{}
+		outcomes, err := g.Run(jobs, func(node string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, dep := range g.Deps(node) {
+				if !done[dep] {
+					t.Errorf("jobs=%d: %s started before its dependency %s", jobs, node, dep)
+				}
+			}
+			done[node] = true
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("jobs=%d: Run() error = %v", jobs, err)
+		}
+		if len(outcomes) != 5 || len(done) != 5 {
+			t.Errorf("jobs=%d: Run() = %v, want every node run once", jobs, outcomes)
+		}
+	}
+}
+
+func TestRunJobs(t *testing.T) {
+	g := build([][]string{{"a"}, {"b"}, {"c"}, {"d"}, {"e"}})
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	release := make(chan struct{})
+	go func() {
+		for range 5 {
+			release <- struct{}{}
+		}
+	}()
+	_, err := g.Run(2, func(node string) error {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+
+		<-release
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peak > 2 {
+		t.Errorf("Run(2) ran %d nodes at once", peak)
+	}
+}
+
+func TestRunFailure(t *testing.T) {
+	g := build([][]string{{"db"}, {"api", "db"}, {"ui", "api"}, {"cache"}})
+	failure := errors.New("install failed")
+
+	outcomes, err := g.Run(1, func(node string) error {
+		if node == "db" {
+			return failure
+		}
+		return nil
+	})
+
+	want := []Outcome{
+		{Node: "db", Err: failure},
+		{Node: "api", Skipped: true, Reason: "blocked by 'db'"},
+		{Node: "ui", Skipped: true, Reason: "blocked by 'api'"},
+		{Node: "cache", Skipped: true, Reason: "not started after 'db' failed"},
+	}
+	if !reflect.DeepEqual(outcomes, want) {
+		t.Errorf("Run() = %+v, want %+v", outcomes, want)
+	}
+
+	var runErr *RunError
+	if !errors.As(err, &runErr) {
+		t.Fatalf("Run() error = %v, want a RunError", err)
+	}
+	if !errors.Is(err, failure) {
+		t.Errorf("Run() error = %v, does not wrap %v", err, failure)
+	}
+	if want := "'db' failed: install failed; not started: api, cache, ui"; err.Error() != want {
+		t.Errorf("Run() error = %q, want %q", err.Error(), want)
+	}
+}
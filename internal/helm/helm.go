@@ -22,44 +22,228 @@ THE SOFTWARE.
 package helm
 
 import (
+    "encoding/json"
+    "errors"
     "fmt"
     "os"
-    "os/exec"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+
+    "go-cli/internal/runner"
+    "gopkg.in/yaml.v3"
 )
 
+var cmdRunner runner.Runner = runner.Exec{}
+
+// SetRunner replaces the runner used to invoke helm.
+func SetRunner(r runner.Runner) {
+    cmdRunner = r
+}
+
+// DefaultRepoTTL is how long a downloaded repository index is used before
+// it is refreshed.
+const DefaultRepoTTL = 24 * time.Hour
+
 type RepoConfig struct {
     URL string `mapstructure:"url"`
 }
 
-func ConfigureRepos(repos map[string]RepoConfig, verbose bool) error {
-    for repoName, repoConfig := range repos {
-        // Build Helm repo add command
-        args := []string{"repo", "add", repoName, repoConfig.URL}
-        
-        // Execute Helm command
-        cmd := exec.Command("helm", args...)
-        
-        if verbose {
-            cmd.Stdout = os.Stdout
-            cmd.Stderr = os.Stderr
+// Chart is a chart installed from a configured repository, Name being
+// "<repository>/<chart>".
+type Chart struct {
+    Name    string
+    Version string
+}
+
+// RepoConflictError reports a repository already known to Helm under the
+// same name with a different URL.
+type RepoConflictError struct {
+    Name     string
+    URL      string
+    Existing string
+}
+
+func (e *RepoConflictError) Error() string {
+    return fmt.Sprintf("helm repository '%s' already points at %s instead of %s, run 'helm repo remove %s' or rename it in helm_repositories",
+        e.Name, e.Existing, e.URL, e.Name)
+}
+
+type listedRepo struct {
+    Name string `json:"name"`
+    URL  string `json:"url"`
+}
+
+// ConfigureRepos adds the repositories Helm does not know yet and updates the
+// known ones whose index is older than ttl or misses a version of charts.
+// Repositories registered with another URL are reported, not replaced.
+func ConfigureRepos(repos map[string]RepoConfig, ttl time.Duration, charts []Chart, verbose bool) error {
+    existing, err := listRepos()
+    if err != nil {
+        return err
+    }
+
+    names := make([]string, 0, len(repos))
+    for name := range repos {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    // Check every conflict before changing anything
+    var conflicts []error
+    var missing, known []string
+    for _, name := range names {
+        url, ok := existing[name]
+        switch {
+        case !ok:
+            missing = append(missing, name)
+        case sameURL(url, repos[name].URL):
+            known = append(known, name)
+        default:
+            conflicts = append(conflicts, &RepoConflictError{Name: name, URL: repos[name].URL, Existing: url})
         }
-        
-        if err := cmd.Run(); err != nil {
-            return fmt.Errorf("helm repo add failed for repository '%s': %w", repoName, err)
+    }
+    if len(conflicts) > 0 {
+        return errors.Join(conflicts...)
+    }
+
+    // Adding a repository downloads its index
+    for _, name := range missing {
+        if err := cmdRunner.Run(runner.Command(verbose, "helm", "repo", "add", name, repos[name].URL)); err != nil {
+            return fmt.Errorf("helm repo add failed for repository '%s': %w", name, err)
         }
     }
-    
-    // Update repositories
-    updateCmd := exec.Command("helm", "repo", "update")
-    
-    if verbose {
-        updateCmd.Stdout = os.Stdout
-        updateCmd.Stderr = os.Stderr
+
+    stale, err := staleRepos(known, ttl, charts)
+    if err != nil {
+        return err
+    }
+    if len(stale) == 0 {
+        return nil
     }
-    
-    if err := updateCmd.Run(); err != nil {
+
+    args := append([]string{"repo", "update"}, stale...)
+    if err := cmdRunner.Run(runner.Command(verbose, "helm", args...)); err != nil {
         return fmt.Errorf("helm repo update failed: %w", err)
     }
-    
     return nil
-}
\ No newline at end of file
+}
+
+// listRepos returns the URL of every repository known to Helm by name.
+func listRepos() (map[string]string, error) {
+    output, err := cmdRunner.Output(runner.Command(false, "helm", "repo", "list", "-o", "json"))
+    if err != nil {
+        // Helm fails rather than printing an empty list
+        var failed *runner.ToolFailedError
+        if errors.As(err, &failed) && strings.Contains(failed.Stderr, "no repositories") {
+            return map[string]string{}, nil
+        }
+        return nil, fmt.Errorf("helm repo list failed: %w", err)
+    }
+
+    repos := map[string]string{}
+    if runner.IsDryRun(cmdRunner) {
+        return repos, nil
+    }
+    if len(strings.TrimSpace(string(output))) == 0 {
+        return nil, errors.New("helm repo list printed nothing")
+    }
+
+    var listed []listedRepo
+    if err := json.Unmarshal(output, &listed); err != nil {
+        return nil, fmt.Errorf("failed to parse helm repo list: %w", err)
+    }
+    for _, repo := range listed {
+        repos[repo.Name] = repo.URL
+    }
+    return repos, nil
+}
+
+func sameURL(a string, b string) bool {
+    return strings.TrimSuffix(a, "/") == strings.TrimSuffix(b, "/")
+}
+
+// staleRepos returns the repositories among names whose cached index is
+// missing, older than ttl or lacks a pinned version of charts.
+func staleRepos(names []string, ttl time.Duration, charts []Chart) ([]string, error) {
+    if len(names) == 0 {
+        return nil, nil
+    }
+
+    cacheDir, err := repositoryCache()
+    if err != nil {
+        return nil, err
+    }
+    if runner.IsDryRun(cmdRunner) {
+        return nil, nil
+    }
+
+    var stale []string
+    for _, name := range names {
+        indexPath := filepath.Join(cacheDir, name+"-index.yaml")
+        info, err := os.Stat(indexPath)
+        if err != nil || time.Since(info.ModTime()) > ttl || !hasVersions(indexPath, name, charts) {
+            stale = append(stale, name)
+        }
+    }
+    return stale, nil
+}
+
+func repositoryCache() (string, error) {
+    output, err := cmdRunner.Output(runner.Command(false, "helm", "env", "HELM_REPOSITORY_CACHE"))
+    if err != nil {
+        return "", fmt.Errorf("failed to locate the helm repository cache: %w", err)
+    }
+    cacheDir := strings.TrimSpace(string(output))
+    if cacheDir == "" && !runner.IsDryRun(cmdRunner) {
+        return "", errors.New("failed to locate the helm repository cache: helm env printed nothing")
+    }
+    return cacheDir, nil
+}
+
+// hasVersions reports whether the index at indexPath lists the exact
+// versions required by the charts of repository repo. Version ranges are
+// left to Helm.
+func hasVersions(indexPath string, repo string, charts []Chart) bool {
+    var wanted []Chart
+    for _, chart := range charts {
+        if strings.HasPrefix(chart.Name, repo+"/") && exactVersion(chart.Version) {
+            wanted = append(wanted, chart)
+        }
+    }
+    if len(wanted) == 0 {
+        return true
+    }
+
+    data, err := os.ReadFile(indexPath)
+    if err != nil {
+        return false
+    }
+    var index struct {
+        Entries map[string][]struct {
+            Version string `yaml:"version"`
+        } `yaml:"entries"`
+    }
+    if err := yaml.Unmarshal(data, &index); err != nil {
+        return false
+    }
+
+    for _, chart := range wanted {
+        found := false
+        for _, entry := range index.Entries[strings.TrimPrefix(chart.Name, repo+"/")] {
+            if strings.TrimPrefix(entry.Version, "v") == strings.TrimPrefix(chart.Version, "v") {
+                found = true
+                break
+            }
+        }
+        if !found {
+            return false
+        }
+    }
+    return true
+}
+
+func exactVersion(version string) bool {
+    return version != "" && !strings.ContainsAny(version, "^~<>=*|, ") && !strings.HasSuffix(version, ".x")
+}
@@ -0,0 +1,244 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package helm
+
+import (
+    "errors"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+
+    "go-cli/internal/runner"
+)
+
+const bitnami = "https://charts.bitnami.com/bitnami"
+
+// useRecorder records the helm commands, answering repo list with listed and
+// env with cacheDir.
+func useRecorder(t *testing.T, listed string, listErr error, cacheDir string) *runner.Recorder {
+    t.Helper()
+    recorder := &runner.Recorder{Stub: runner.StubReplies(map[string]runner.Reply{
+        "helm repo list": {Output: listed, Err: listErr},
+        "helm env":       {Output: cacheDir + "\n"},
+    })}
+    SetRunner(recorder)
+    t.Cleanup(func() { SetRunner(runner.Exec{}) })
+    return recorder
+}
+
+// writeIndex writes the cached index of repo listing versions of redis, last
+// modified age ago.
+func writeIndex(t *testing.T, cacheDir string, repo string, age time.Duration, versions ...string) {
+    t.Helper()
+    index := "apiVersion: v1\nentries:\n  redis:\n"
+    for _, version := range versions {
+        index += "    - name: redis\n      version: " + version + "\n"
+    }
+    path := filepath.Join(cacheDir, repo+"-index.yaml")
+    if err := os.WriteFile(path, []byte(index), 0644); err != nil {
+        t.Fatal(err)
+    }
+    modified := time.Now().Add(-age)
+    if err := os.Chtimes(path, modified, modified); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestConfigureRepos(t *testing.T) {
+    repos := map[string]RepoConfig{"bitnami": {URL: bitnami}, "jetstack": {URL: "https://charts.jetstack.io"}}
+    bothListed := `[{"name":"bitnami","url":"https://charts.bitnami.com/bitnami/"},{"name":"jetstack","url":"https://charts.jetstack.io"}]`
+
+    tests := []struct {
+        name      string
+        listed    string
+        listErr   error
+        indexes   func(t *testing.T, cacheDir string)
+        charts    []Chart
+        wantLines []string
+    }{
+        {
+            name:    "no repository known",
+            listErr: &runner.ToolFailedError{Tool: "helm", ExitCode: 1, Stderr: "Error: no repositories to show"},
+            wantLines: []string{
+                "helm repo list -o json",
+                "helm repo add bitnami " + bitnami,
+                "helm repo add jetstack https://charts.jetstack.io",
+            },
+        },
+        {
+            name:   "one repository missing",
+            listed: `[{"name":"jetstack","url":"https://charts.jetstack.io"}]`,
+            indexes: func(t *testing.T, cacheDir string) {
+                writeIndex(t, cacheDir, "jetstack", time.Hour)
+            },
+            wantLines: []string{
+                "helm repo list -o json",
+                "helm repo add bitnami " + bitnami,
+                "helm env HELM_REPOSITORY_CACHE",
+            },
+        },
+        {
+            name:   "fresh indexes",
+            listed: bothListed,
+            indexes: func(t *testing.T, cacheDir string) {
+                writeIndex(t, cacheDir, "bitnami", time.Hour, "18.0.0", "18.1.0")
+                writeIndex(t, cacheDir, "jetstack", time.Hour)
+            },
+            charts:    []Chart{{Name: "bitnami/redis", Version: "18.1.0"}, {Name: "bitnami/redis", Version: "^17.0.0"}},
+            wantLines: []string{"helm repo list -o json", "helm env HELM_REPOSITORY_CACHE"},
+        },
+        {
+            name:   "expired and missing indexes",
+            listed: bothListed,
+            indexes: func(t *testing.T, cacheDir string) {
+                writeIndex(t, cacheDir, "bitnami", 48*time.Hour)
+            },
+            wantLines: []string{"helm repo list -o json", "helm env HELM_REPOSITORY_CACHE", "helm repo update bitnami jetstack"},
+        },
+        {
+            name:   "pinned version missing from the index",
+            listed: bothListed,
+            indexes: func(t *testing.T, cacheDir string) {
+                writeIndex(t, cacheDir, "bitnami", time.Hour, "18.0.0")
+                writeIndex(t, cacheDir, "jetstack", time.Hour)
+            },
+            charts:    []Chart{{Name: "bitnami/redis", Version: "18.1.0"}},
+            wantLines: []string{"helm repo list -o json", "helm env HELM_REPOSITORY_CACHE", "helm repo update bitnami"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cacheDir := t.TempDir()
+            if tt.indexes != nil {
+                tt.indexes(t, cacheDir)
+            }
+            recorder := useRecorder(t, tt.listed, tt.listErr, cacheDir)
+
+            if err := ConfigureRepos(repos, DefaultRepoTTL, tt.charts, false); err != nil {
+                t.Fatal(err)
+            }
+            if got := recorder.Lines(); !reflect.DeepEqual(got, tt.wantLines) {
+                t.Errorf("ConfigureRepos() ran\n%q\nwant\n%q", got, tt.wantLines)
+            }
+        })
+    }
+}
+
+func TestConfigureReposConflict(t *testing.T) {
+    recorder := useRecorder(t, `[{"name":"bitnami","url":"https://example.com/charts"}]`, nil, t.TempDir())
+
+    err := ConfigureRepos(map[string]RepoConfig{"bitnami": {URL: bitnami}, "jetstack": {URL: "https://charts.jetstack.io"}}, DefaultRepoTTL, nil, false)
+    var conflict *RepoConflictError
+    if !errors.As(err, &conflict) {
+        t.Fatalf("ConfigureRepos() error = %v, want a RepoConflictError", err)
+    }
+    if want := (RepoConflictError{Name: "bitnami", URL: bitnami, Existing: "https://example.com/charts"}); *conflict != want {
+        t.Errorf("RepoConflictError = %+v, want %+v", *conflict, want)
+    }
+    // Nothing is added while a conflict remains
+    if got := recorder.Lines(); !reflect.DeepEqual(got, []string{"helm repo list -o json"}) {
+        t.Errorf("ConfigureRepos() ran %q", got)
+    }
+}
+
+func TestConfigureReposEmptyOutput(t *testing.T) {
+    useRecorder(t, "", nil, "")
+
+    if err := ConfigureRepos(map[string]RepoConfig{"bitnami": {URL: bitnami}}, DefaultRepoTTL, nil, false); err == nil {
+        t.Error("ConfigureRepos() succeeded although helm repo list printed nothing")
+    }
+}
+
+func TestConfigureReposDryRun(t *testing.T) {
+    var out strings.Builder
+    SetRunner(&runner.DryRun{Out: &out})
+    t.Cleanup(func() { SetRunner(runner.Exec{}) })
+
+    if err := ConfigureRepos(map[string]RepoConfig{"bitnami": {URL: bitnami}}, DefaultRepoTTL, nil, false); err != nil {
+        t.Fatal(err)
+    }
+    if want := "$ helm repo list -o json\n$ helm repo add bitnami " + bitnami + "\n"; out.String() != want {
+        t.Errorf("dry run printed\n%s\nwant\n%s", out.String(), want)
+    }
+}
+
+func TestStaleRepos(t *testing.T) {
+    cacheDir := t.TempDir()
+    writeIndex(t, cacheDir, "fresh", time.Hour, "18.1.0", "v17.3.2")
+    writeIndex(t, cacheDir, "expired", 25*time.Hour, "18.1.0")
+    useRecorder(t, "", nil, cacheDir)
+
+    tests := []struct {
+        name   string
+        repos  []string
+        charts []Chart
+        want   []string
+    }{
+        {name: "no repository", want: nil},
+        {name: "fresh index", repos: []string{"fresh"}, want: nil},
+        {name: "expired index", repos: []string{"fresh", "expired"}, want: []string{"expired"}},
+        {name: "missing index", repos: []string{"missing"}, want: []string{"missing"}},
+        {name: "pinned versions listed", repos: []string{"fresh"}, charts: []Chart{{Name: "fresh/redis", Version: "18.1.0"}, {Name: "fresh/redis", Version: "17.3.2"}}},
+        {name: "pinned version missing", repos: []string{"fresh"}, charts: []Chart{{Name: "fresh/redis", Version: "18.2.0"}}, want: []string{"fresh"}},
+        {name: "chart missing", repos: []string{"fresh"}, charts: []Chart{{Name: "fresh/postgresql", Version: "12.0.0"}}, want: []string{"fresh"}},
+        {name: "chart of another repository", repos: []string{"fresh"}, charts: []Chart{{Name: "other/redis", Version: "1.0.0"}}},
+        {
+            name:   "version ranges left to helm",
+            repos:  []string{"fresh"},
+            charts: []Chart{{Name: "fresh/redis", Version: "^19.0.0"}, {Name: "fresh/redis", Version: "19.x"}, {Name: "fresh/redis", Version: ">=19.0.0, <20"}, {Name: "fresh/redis"}},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := staleRepos(tt.repos, DefaultRepoTTL, tt.charts)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("staleRepos() = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestExactVersion(t *testing.T) {
+    tests := map[string]bool{
+        "18.1.0":        true,
+        "v18.1.0":       true,
+        "1.0.0-rc.1":    true,
+        "":              false,
+        "^18.0.0":       false,
+        "~18.1":         false,
+        ">=18.0.0 <19":  false,
+        "18.x":          false,
+        "*":             false,
+        "18.1.0 || 19":  false,
+    }
+    for version, want := range tests {
+        if got := exactVersion(version); got != want {
+            t.Errorf("exactVersion(%q) = %v, want %v", version, got, want)
+        }
+    }
+}
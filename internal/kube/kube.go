@@ -0,0 +1,75 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kube
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFiles returns the kubeconfig files in the order kubectl and helm read
+// them: the KUBECONFIG list, or $HOME/.kube/config.
+func ConfigFiles() []string {
+	if list := os.Getenv("KUBECONFIG"); list != "" {
+		var files []string
+		for _, file := range filepath.SplitList(list) {
+			if file != "" {
+				files = append(files, file)
+			}
+		}
+		return files
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{filepath.Join(home, ".kube", "config")}
+}
+
+// CurrentContext returns the current kubeconfig context, set by the first
+// file defining one, or an empty string when none is.
+func CurrentContext() (string, error) {
+	for _, file := range ConfigFiles() {
+		data, err := os.ReadFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read kubeconfig: %w", err)
+		}
+
+		var config struct {
+			CurrentContext string `yaml:"current-context"`
+		}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return "", fmt.Errorf("failed to parse kubeconfig %s: %w", file, err)
+		}
+		if config.CurrentContext != "" {
+			return config.CurrentContext, nil
+		}
+	}
+	return "", nil
+}
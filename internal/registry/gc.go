@@ -0,0 +1,171 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"go-cli/internal/runner"
+)
+
+var cmdRunner runner.Runner = runner.Exec{}
+
+// SetRunner replaces the runner used to invoke docker.
+func SetRunner(r runner.Runner) {
+	cmdRunner = r
+}
+
+// Path of the configuration file inside the registry:2 image
+const registryConfigFile = "/etc/docker/registry/config.yml"
+
+// List returns every tag of every repository, newest first within a repository.
+func List(client *Client) ([]Image, error) {
+	repositories, err := client.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(repositories)
+
+	var images []Image
+	for _, repository := range repositories {
+		repositoryImages, err := listRepository(client, repository)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, repositoryImages...)
+	}
+	return images, nil
+}
+
+func listRepository(client *Client, repository string) ([]Image, error) {
+	tags, err := client.Tags(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []Image
+	for _, tag := range tags {
+		image, err := client.Inspect(repository, tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect %s:%s: %w", repository, tag, err)
+		}
+		images = append(images, image)
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		if !images[i].Created.Equal(images[j].Created) {
+			return images[i].Created.After(images[j].Created)
+		}
+		return images[i].Tag > images[j].Tag
+	})
+	return images, nil
+}
+
+// Remove deletes repository:tag and returns the other tags removed with it
+// because they point at the same manifest.
+func Remove(client *Client, repository string, tag string) ([]string, error) {
+	images, err := listRepository(client, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	var target *Image
+	for i := range images {
+		if images[i].Tag == tag {
+			target = &images[i]
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("image %s:%s not found in the registry", repository, tag)
+	}
+
+	var others []string
+	for _, image := range images {
+		if image.Digest == target.Digest && image.Tag != tag {
+			others = append(others, image.Tag)
+		}
+	}
+	return others, client.Delete(repository, target.Digest)
+}
+
+// Prune deletes all but the keep newest tags of every repository and returns
+// the deleted images. Manifests still pointed at by a kept tag are left alone.
+func Prune(client *Client, keep int) ([]Image, error) {
+	repositories, err := client.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(repositories)
+
+	var deleted []Image
+	for _, repository := range repositories {
+		images, err := listRepository(client, repository)
+		if err != nil {
+			return deleted, err
+		}
+		if len(images) <= keep {
+			continue
+		}
+
+		kept := make(map[string]bool)
+		for _, image := range images[:keep] {
+			kept[image.Digest] = true
+		}
+		removed := make(map[string]bool)
+		for _, image := range images[keep:] {
+			if kept[image.Digest] {
+				continue
+			}
+			if !removed[image.Digest] {
+				if err := client.Delete(repository, image.Digest); err != nil {
+					return deleted, fmt.Errorf("failed to delete %s: %w", image, err)
+				}
+				removed[image.Digest] = true
+			}
+			deleted = append(deleted, image)
+		}
+	}
+	return deleted, nil
+}
+
+// GarbageCollect frees the disk space of deleted images. The registry container
+// is stopped meanwhile, so that no push races with the collection, which runs in
+// a throwaway container sharing its storage. The registry is started again
+// whatever the outcome.
+func GarbageCollect(container string, image string, verbose bool) (err error) {
+	if err := cmdRunner.Run(runner.Command(verbose, "docker", "stop", container)); err != nil {
+		return fmt.Errorf("failed to stop registry %s: %w", container, err)
+	}
+	defer func() {
+		if startErr := cmdRunner.Run(runner.Command(verbose, "docker", "start", container)); startErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to start registry %s: %w", container, startErr))
+		}
+	}()
+
+	cmd := runner.Command(verbose, "docker", "run", "--rm", "--volumes-from", container, "--entrypoint", "registry", image,
+		"garbage-collect", "--delete-untagged", registryConfigFile)
+	if err := cmdRunner.Run(cmd); err != nil {
+		return fmt.Errorf("registry garbage collection failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package registry
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go-cli/internal/cluster/registrytest"
+	"go-cli/internal/runner"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newRegistry(t *testing.T) (*registrytest.Server, *Client) {
+	t.Helper()
+	server := registrytest.NewServer()
+	t.Cleanup(server.Close)
+	return server, NewClient(server.Host())
+}
+
+func names(images []Image) []string {
+	var names []string
+	for _, image := range images {
+		names = append(names, image.String())
+	}
+	return names
+}
+
+func TestList(t *testing.T) {
+	server, client := newRegistry(t)
+	server.Push("api", "1.0", epoch)
+	server.Push("api", "1.1", epoch.Add(time.Hour))
+	server.Push("web", "latest", epoch)
+	server.Push("team/worker", "a", epoch)
+	server.Push("team/worker", "b", epoch)
+
+	images, err := List(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"api:1.1", "api:1.0", "team/worker:b", "team/worker:a", "web:latest"}
+	if got := names(images); !reflect.DeepEqual(got, want) {
+		t.Errorf("List() = %v, want %v", got, want)
+	}
+	if !images[0].Created.Equal(epoch.Add(time.Hour)) {
+		t.Errorf("List()[0].Created = %v, want %v", images[0].Created, epoch.Add(time.Hour))
+	}
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		name       string
+		tag        string
+		wantOthers []string
+		wantTags   []string
+		wantErr    bool
+	}{
+		{name: "single tag", tag: "1.1", wantTags: []string{"1.0", "stable"}},
+		{name: "shared manifest", tag: "1.0", wantOthers: []string{"stable"}, wantTags: []string{"1.1"}},
+		{name: "unknown tag", tag: "2.0", wantTags: []string{"1.0", "1.1", "stable"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newRegistry(t)
+			server.Push("api", "1.0", epoch)
+			server.Push("api", "stable", epoch)
+			server.Push("api", "1.1", epoch.Add(time.Hour))
+
+			others, err := Remove(client, "api", tt.tag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Remove() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(others, tt.wantOthers) {
+				t.Errorf("Remove() = %v, want %v", others, tt.wantOthers)
+			}
+			if got := server.Tags("api"); !reflect.DeepEqual(got, tt.wantTags) {
+				t.Errorf("tags left = %v, want %v", got, tt.wantTags)
+			}
+		})
+	}
+}
+
+func TestRemoveDeleteDisabled(t *testing.T) {
+	server, client := newRegistry(t)
+	server.DeleteDisabled = true
+	server.Push("api", "1.0", epoch)
+
+	if _, err := Remove(client, "api", "1.0"); !errors.Is(err, ErrDeleteDisabled) {
+		t.Errorf("Remove() error = %v, want %v", err, ErrDeleteDisabled)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		name        string
+		keep        int
+		wantDeleted []string
+		wantTags    []string
+	}{
+		{name: "keep all", keep: 5, wantTags: []string{"1", "2", "3", "latest"}},
+		{name: "keep newest", keep: 1, wantDeleted: []string{"api:2", "api:1"}, wantTags: []string{"3", "latest"}},
+		{name: "keep two", keep: 2, wantDeleted: []string{"api:2", "api:1"}, wantTags: []string{"3", "latest"}},
+		{name: "keep none", keep: 0, wantDeleted: []string{"api:latest", "api:3", "api:2", "api:1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newRegistry(t)
+			server.Push("api", "1", epoch)
+			server.Push("api", "2", epoch.Add(time.Hour))
+			// latest and 3 share a manifest, deleting one deletes both
+			server.Push("api", "3", epoch.Add(2*time.Hour))
+			server.Push("api", "latest", epoch.Add(2*time.Hour))
+
+			deleted, err := Prune(client, tt.keep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(deleted); !reflect.DeepEqual(got, tt.wantDeleted) {
+				t.Errorf("Prune() = %v, want %v", got, tt.wantDeleted)
+			}
+			if got := server.Tags("api"); !reflect.DeepEqual(got, tt.wantTags) {
+				t.Errorf("tags left = %v, want %v", got, tt.wantTags)
+			}
+		})
+	}
+}
+
+func TestPruneDryRun(t *testing.T) {
+	server, client := newRegistry(t)
+	var out strings.Builder
+	client.DryRun = &out
+	server.Push("api", "1", epoch)
+	server.Push("api", "2", epoch.Add(time.Hour))
+
+	deleted, err := Prune(client, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(deleted); !reflect.DeepEqual(got, []string{"api:1"}) {
+		t.Errorf("Prune() = %v, want [api:1]", got)
+	}
+	if got := server.Tags("api"); len(got) != 2 {
+		t.Errorf("tags left = %v, want both", got)
+	}
+	if !strings.HasPrefix(out.String(), "# DELETE "+client.BaseURL+"/v2/api/manifests/sha256:") {
+		t.Errorf("dry run printed %q", out.String())
+	}
+}
+
+func TestGarbageCollect(t *testing.T) {
+	collect := "docker run --rm --volumes-from local-registry --entrypoint registry registry:2 garbage-collect --delete-untagged /etc/docker/registry/config.yml"
+	tests := []struct {
+		name      string
+		failOn    string
+		wantLines []string
+		wantErr   bool
+	}{
+		{
+			name:      "success",
+			wantLines: []string{"docker stop local-registry", collect, "docker start local-registry"},
+		},
+		{
+			name:      "collection fails",
+			failOn:    "docker run",
+			wantLines: []string{"docker stop local-registry", collect, "docker start local-registry"},
+			wantErr:   true,
+		},
+		{
+			name:      "stop fails",
+			failOn:    "docker stop",
+			wantLines: []string{"docker stop local-registry"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replies := map[string]runner.Reply{}
+			if tt.failOn != "" {
+				replies[tt.failOn] = runner.Reply{Err: errors.New("failed")}
+			}
+			recorder := &runner.Recorder{Stub: runner.StubReplies(replies)}
+			SetRunner(recorder)
+			t.Cleanup(func() { SetRunner(runner.Exec{}) })
+
+			err := GarbageCollect("local-registry", "registry:2", false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GarbageCollect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := recorder.Lines(); !reflect.DeepEqual(got, tt.wantLines) {
+				t.Errorf("GarbageCollect() ran %q, want %q", got, tt.wantLines)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Media types of the manifests accepted from the registry
+var manifestTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+// ErrDeleteDisabled reports a registry started without REGISTRY_STORAGE_DELETE_ENABLED.
+var ErrDeleteDisabled = errors.New("the registry does not allow deleting images, recreate it with 'go-cli cluster delete --remove-registry' and 'go-cli cluster create'")
+
+// Client talks to a registry through its HTTP API.
+type Client struct {
+	// BaseURL is the URL of the registry, e.g. http://localhost:5000
+	BaseURL string
+	HTTP    *http.Client
+	// DryRun, when set, receives the deletions instead of the registry
+	DryRun io.Writer
+}
+
+// NewClient returns a client of the registry listening on address, e.g. localhost:5000.
+func NewClient(address string) *Client {
+	return &Client{BaseURL: "http://" + address, HTTP: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// APIError is an error returned by the registry.
+type APIError struct {
+	Status int
+	Code   string
+	Detail string
+}
+
+func (e *APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("registry returned %d %s: %s", e.Status, e.Code, e.Detail)
+	}
+	return fmt.Sprintf("registry returned %d", e.Status)
+}
+
+// Catalog returns the repositories of the registry.
+func (c *Client) Catalog() ([]string, error) {
+	var repositories []string
+	next := "/v2/_catalog?n=100"
+	for next != "" {
+		var page struct {
+			Repositories []string `json:"repositories"`
+		}
+		resp, err := c.get(next, "", &page)
+		if err != nil {
+			return nil, err
+		}
+		repositories = append(repositories, page.Repositories...)
+		next = nextPage(resp.Header.Get("Link"))
+	}
+	return repositories, nil
+}
+
+// nextPage extracts the path of the next page from a Link header such as
+// </v2/_catalog?last=x&n=100>; rel="next".
+func nextPage(link string) string {
+	target, _, ok := strings.Cut(link, ";")
+	if !ok || !strings.Contains(link, `rel="next"`) {
+		return ""
+	}
+	return strings.Trim(strings.TrimSpace(target), "<>")
+}
+
+// Tags returns the tags of repository.
+func (c *Client) Tags(repository string) ([]string, error) {
+	var tags []string
+	next := "/v2/" + repository + "/tags/list?n=100"
+	for next != "" {
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		resp, err := c.get(next, "", &page)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, page.Tags...)
+		next = nextPage(resp.Header.Get("Link"))
+	}
+	return tags, nil
+}
+
+// Image is a tag of a repository with the manifest it points at.
+type Image struct {
+	Repository string
+	Tag        string
+	Digest     string
+	// Created is the creation time of the image, zero when unknown
+	Created time.Time
+}
+
+func (i Image) String() string {
+	return i.Repository + ":" + i.Tag
+}
+
+// Inspect resolves the digest and creation time of repository:tag.
+func (c *Client) Inspect(repository string, tag string) (Image, error) {
+	image := Image{Repository: repository, Tag: tag}
+
+	var manifest struct {
+		MediaType string `json:"mediaType"`
+		Config    struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+		Manifests []struct {
+			Digest string `json:"digest"`
+		} `json:"manifests"`
+	}
+	resp, err := c.get("/v2/"+repository+"/manifests/"+tag, strings.Join(manifestTypes, ", "), &manifest)
+	if err != nil {
+		return image, err
+	}
+	image.Digest = resp.Header.Get("Docker-Content-Digest")
+
+	// Image indexes point at one manifest per platform, which share their creation time
+	if len(manifest.Manifests) > 0 && manifest.Config.Digest == "" {
+		if _, err := c.get("/v2/"+repository+"/manifests/"+manifest.Manifests[0].Digest, strings.Join(manifestTypes, ", "), &manifest); err != nil {
+			return image, err
+		}
+	}
+	if manifest.Config.Digest == "" {
+		return image, nil
+	}
+
+	var config struct {
+		Created time.Time `json:"created"`
+	}
+	if _, err := c.get("/v2/"+repository+"/blobs/"+manifest.Config.Digest, "", &config); err != nil {
+		return image, err
+	}
+	image.Created = config.Created
+	return image, nil
+}
+
+// Delete deletes the manifest digest of repository, and with it every tag pointing at it.
+func (c *Client) Delete(repository string, digest string) error {
+	path := "/v2/" + repository + "/manifests/" + digest
+	if c.DryRun != nil {
+		fmt.Fprintf(c.DryRun, "# DELETE %s%s\n", c.BaseURL, path)
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, c.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("registry not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusMethodNotAllowed {
+		return ErrDeleteDisabled
+	}
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return apiError(resp)
+	}
+	return nil
+}
+
+func (c *Client) get(path string, accept string, v any) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("registry not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return nil, fmt.Errorf("failed to parse registry response to %s: %w", path, err)
+	}
+	return resp, nil
+}
+
+func apiError(resp *http.Response) error {
+	var body struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	e := &APIError{Status: resp.StatusCode}
+	if json.NewDecoder(resp.Body).Decode(&body) == nil && len(body.Errors) > 0 {
+		e.Code, e.Detail = body.Errors[0].Code, body.Errors[0].Message
+	}
+	return e
+}
+
+// ParseReference splits an image reference such as api:1.0 or
+// localhost:5000/api:1.0 into its repository and tag, dropping the address
+// of the registry.
+func ParseReference(ref string, address string) (string, string, error) {
+	ref = strings.TrimPrefix(ref, address+"/")
+
+	slash := strings.LastIndex(ref, "/")
+	colon := strings.LastIndex(ref, ":")
+	if colon < slash || colon < 0 {
+		return "", "", fmt.Errorf("image reference '%s' has no tag", ref)
+	}
+	return ref[:colon], ref[colon+1:], nil
+}
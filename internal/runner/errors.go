@@ -0,0 +1,135 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// ToolMissingError reports an external tool that is not installed or not in PATH.
+type ToolMissingError struct {
+	Tool string
+	Err  error
+}
+
+func (e *ToolMissingError) Error() string {
+	return fmt.Sprintf("%s is not installed or not in PATH", e.Tool)
+}
+
+func (e *ToolMissingError) Unwrap() error {
+	return e.Err
+}
+
+// Number of output lines attached to a ToolFailedError
+const tailLines = 20
+
+// ToolFailedError reports an external tool that exited with a non-zero status.
+// Stderr holds the end of what the tool wrote to its standard error. When the
+// output of the tool was not shown, Tail holds its last lines. LogFile points
+// at the full output of the run.
+type ToolFailedError struct {
+	Tool     string
+	Args     []string
+	ExitCode int
+	Stderr   string
+	Tail     []string
+	LogFile  string
+}
+
+func (e *ToolFailedError) Error() string {
+	msg := fmt.Sprintf("%s exited with code %d", e.Tool, e.ExitCode)
+	if len(e.Tail) > 0 {
+		msg += ":\n    " + strings.Join(e.Tail, "\n    ")
+	} else if line := lastLine(e.Stderr); line != "" {
+		msg += ": " + line
+	}
+	if e.LogFile != "" {
+		msg += "\nfull output in " + e.LogFile
+	}
+	return msg
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// LastLines returns the last n lines of s, ignoring surrounding blank space.
+func LastLines(s string, n int) []string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// wrapError turns the error of an executed command into a typed error.
+func wrapError(cmd Cmd, err error, stderr *tailBuffer, output *tailBuffer, logFile string) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return &ToolMissingError{Tool: cmd.Name, Err: err}
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		failed := &ToolFailedError{Tool: cmd.Name, Args: cmd.Args, ExitCode: exitErr.ExitCode(), Stderr: stderr.String(), LogFile: logFile}
+		if output != nil {
+			failed.Tail = LastLines(output.String(), tailLines)
+		}
+		return failed
+	}
+	return err
+}
+
+// tailBuffer keeps the last bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf bytes.Buffer
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf.Write(p)
+	if extra := b.buf.Len() - b.max; extra > 0 {
+		b.buf.Next(extra)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,145 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestToolMissing(t *testing.T) {
+	err := Exec{}.Run(Command(false, "go-cli-missing-tool"))
+
+	var missing *ToolMissingError
+	if !errors.As(err, &missing) || missing.Tool != "go-cli-missing-tool" {
+		t.Fatalf("Run() error = %v, want a *ToolMissingError", err)
+	}
+	if !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("Run() error = %v, want it to wrap exec.ErrNotFound", err)
+	}
+}
+
+func TestToolFailed(t *testing.T) {
+	var lines []string
+	for i := 11; i <= 30; i++ {
+		lines = append(lines, fmt.Sprint(i))
+	}
+
+	tests := []struct {
+		name       string
+		script     string
+		shown      bool
+		wantCode   int
+		wantStderr string
+		wantTail   []string
+		wantErr    string
+	}{
+		{
+			name:     "output kept when hidden",
+			script:   "echo x; exit 3",
+			wantCode: 3,
+			wantTail: []string{"x"},
+			wantErr:  "sh exited with code 3:\n    x",
+		},
+		{
+			name:     "output not repeated when shown",
+			script:   "echo x; exit 3",
+			shown:    true,
+			wantCode: 3,
+			wantErr:  "sh exited with code 3",
+		},
+		{
+			name:       "last stderr line when shown",
+			script:     "echo x; echo first >&2; echo last >&2; exit 2",
+			shown:      true,
+			wantCode:   2,
+			wantStderr: "first\nlast\n",
+			wantErr:    "sh exited with code 2: last",
+		},
+		{
+			name:     "tail limited",
+			script:   "i=0; while [ $i -lt 30 ]; do i=$((i+1)); echo $i; done; exit 1",
+			wantCode: 1,
+			wantTail: lines,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := Command(false, "sh", "-c", tt.script)
+			if tt.shown {
+				cmd = CommandWith(&bytes.Buffer{}, &bytes.Buffer{}, "sh", "-c", tt.script)
+			}
+			err := Exec{}.Run(cmd)
+
+			var failed *ToolFailedError
+			if !errors.As(err, &failed) {
+				t.Fatalf("Run() error = %v, want a *ToolFailedError", err)
+			}
+			if failed.Tool != "sh" || failed.ExitCode != tt.wantCode || failed.Stderr != tt.wantStderr {
+				t.Errorf("Run() error = %+v, want code %d and stderr %q", failed, tt.wantCode, tt.wantStderr)
+			}
+			if !reflect.DeepEqual(failed.Tail, tt.wantTail) {
+				t.Errorf("Tail = %q, want %q", failed.Tail, tt.wantTail)
+			}
+			if tt.wantErr != "" && err.Error() != tt.wantErr {
+				t.Errorf("Error() = %q, want %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOutputFailed(t *testing.T) {
+	output, err := Exec{}.Output(Command(false, "sh", "-c", "echo out; echo oops >&2; exit 3"))
+
+	var failed *ToolFailedError
+	if !errors.As(err, &failed) || failed.ExitCode != 3 || failed.Stderr != "oops\n" || failed.Tail != nil {
+		t.Fatalf("Output() error = %#v, want code 3 with stderr only", err)
+	}
+	if string(output) != "out\n" {
+		t.Errorf("Output() = %q, want %q", output, "out\n")
+	}
+	if err.Error() != "sh exited with code 3: oops" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{max: 5}
+	for _, write := range []struct{ data, want string }{
+		{"abc", "abc"},
+		{"defgh", "defgh"},
+		{"ij", "fghij"},
+		{"0123456789", "56789"},
+	} {
+		if n, err := b.Write([]byte(write.data)); n != len(write.data) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", write.data, n, err)
+		}
+		if got := b.String(); got != write.want {
+			t.Errorf("after Write(%q) String() = %q, want %q", write.data, got, write.want)
+		}
+	}
+}
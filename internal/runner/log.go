@@ -0,0 +1,207 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Number of log files kept in the log directory
+const keepLogs = 20
+
+// Log records the output of every command run by Exec into one file per CLI
+// run. The file is only created once a command writes to it.
+type Log struct {
+	path string
+
+	mu     sync.Mutex
+	file   *os.File
+	failed bool
+	seq    int
+}
+
+// NewLog returns a log writing to a new file in dir named after the current time.
+func NewLog(dir string) *Log {
+	name := fmt.Sprintf("%s-%d.log", time.Now().Format("20060102-150405"), os.Getpid())
+	return &Log{path: filepath.Join(dir, name)}
+}
+
+// Path returns the log file path, or an empty string when nothing could be written to it.
+func (l *Log) Path() string {
+	if l == nil {
+		return ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.failed {
+		return ""
+	}
+	return l.path
+}
+
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// command starts the log of one command, whose lines are numbered so that
+// commands running concurrently can be told apart.
+func (l *Log) command(cmd Cmd) *commandLog {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	l.seq++
+	c := &commandLog{log: l, prefix: fmt.Sprintf("[%d] ", l.seq)}
+	l.mu.Unlock()
+
+	header := "$ " + cmd.String()
+	if cmd.Dir != "" {
+		header += "  (in " + cmd.Dir + ")"
+	}
+	l.write([]byte(c.prefix + header + "\n"))
+	return c
+}
+
+func (l *Log) write(p []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.failed {
+		return
+	}
+	if l.file == nil {
+		if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+			l.failed = true
+			return
+		}
+		pruneLogs(filepath.Dir(l.path), keepLogs-1)
+		file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			l.failed = true
+			return
+		}
+		l.file = file
+	}
+	l.file.Write(p)
+}
+
+// pruneLogs removes the oldest log files of dir, keeping the keep newest.
+func pruneLogs(dir string, keep int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	var logs []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".log") {
+			logs = append(logs, entry.Name())
+		}
+	}
+	// Names start with a timestamp, so they sort from oldest to newest
+	sort.Strings(logs)
+
+	for len(logs) > keep {
+		os.Remove(filepath.Join(dir, logs[0]))
+		logs = logs[1:]
+	}
+}
+
+// commandLog writes the complete output lines of one command to the log.
+type commandLog struct {
+	log    *Log
+	prefix string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (c *commandLog) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.buf = append(c.buf, p...)
+	for {
+		i := bytes.IndexByte(c.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		c.log.write(append([]byte(c.prefix), c.buf[:i+1]...))
+		c.buf = c.buf[i+1:]
+	}
+}
+
+// finish writes the last incomplete line and the exit status of the command.
+func (c *commandLog) finish(err error) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.buf) > 0 {
+		c.log.write(append(append([]byte(c.prefix), c.buf...), '\n'))
+		c.buf = nil
+	}
+	status := "ok"
+	if err != nil {
+		status = err.Error()
+	}
+	c.log.write([]byte(c.prefix + "# " + status + "\n"))
+}
+
+// writers drops the nil writers of ws, and typed nil command logs.
+func writers(ws ...io.Writer) io.Writer {
+	var kept []io.Writer
+	for _, w := range ws {
+		if w == nil {
+			continue
+		}
+		if c, ok := w.(*commandLog); ok && c == nil {
+			continue
+		}
+		kept = append(kept, w)
+	}
+	switch len(kept) {
+	case 0:
+		return nil
+	case 1:
+		return kept[0]
+	}
+	return io.MultiWriter(kept...)
+}
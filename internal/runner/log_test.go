@@ -0,0 +1,142 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	log := NewLog(dir)
+	exec := Exec{Log: log}
+
+	err := exec.Run(Command(false, "sh", "-c", "echo x; exit 3"))
+	var failed *ToolFailedError
+	if !errors.As(err, &failed) {
+		t.Fatalf("Run() error = %v, want a *ToolFailedError", err)
+	}
+	if failed.LogFile != log.Path() || !strings.HasSuffix(err.Error(), "\nfull output in "+log.Path()) {
+		t.Errorf("Run() error = %q, want it to point at %s", err, log.Path())
+	}
+
+	if _, err := exec.Output(Command(false, "sh", "-c", "printf partial >&2")); err != nil {
+		t.Fatalf("Output() error = %v", err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	data, err := os.ReadFile(log.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"[1] $ sh -c 'echo x; exit 3'",
+		"[1] x",
+		"[1] # exit status 3",
+		"[2] $ sh -c 'printf partial >&2'",
+		"[2] partial",
+		"[2] # ok",
+	}, "\n") + "\n"
+	if string(data) != want {
+		t.Errorf("log = %q, want %q", data, want)
+	}
+}
+
+func TestLogWithoutCommands(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	log := NewLog(dir)
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("log directory created without any command: %v", err)
+	}
+}
+
+func TestLogUnwritable(t *testing.T) {
+	// The log directory cannot be created below a file
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	log := NewLog(filepath.Join(file, "logs"))
+
+	err := Exec{Log: log}.Run(Command(false, "sh", "-c", "echo x; exit 3"))
+	if err == nil {
+		t.Fatal("Run() error = nil")
+	}
+	if log.Path() != "" || strings.Contains(err.Error(), "full output in") {
+		t.Errorf("Path() = %q, error = %q, want no log file", log.Path(), err)
+	}
+}
+
+func TestLogPrunesOldFiles(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 25 {
+		name := fmt.Sprintf("20240101-0000%02d-1.log", i)
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	log := NewLog(dir)
+	if err := (Exec{Log: log}).Run(Command(false, "sh", "-c", "echo x")); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	log.Close()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs []string
+	notes := false
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".log") {
+			logs = append(logs, entry.Name())
+		}
+		notes = notes || entry.Name() == "notes.txt"
+	}
+	sort.Strings(logs)
+
+	if len(logs) != keepLogs {
+		t.Fatalf("%d log files kept, want %d: %v", len(logs), keepLogs, logs)
+	}
+	// The 6 oldest files make room for the new one
+	if logs[0] != "20240101-000006-1.log" || logs[len(logs)-1] != filepath.Base(log.Path()) {
+		t.Errorf("kept %v", logs)
+	}
+	if !notes {
+		t.Error("files other than logs were removed")
+	}
+}
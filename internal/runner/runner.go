@@ -0,0 +1,287 @@
+/*
+Copyright © 2024 Mathieu DE SOUSA <m.desousa@bl-solutions.co>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package runner
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Cmd describes a single invocation of an external tool (docker, k3d, helm...).
+type Cmd struct {
+	Name string
+	Args []string
+	Dir  string
+	// Env holds NAME=value entries added to the environment, kept out of the
+	// printed and logged command lines so they can carry secrets
+	Env    []string
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Command builds a Cmd, wiring its output to the terminal when verbose is set.
+func Command(verbose bool, name string, args ...string) Cmd {
+	if verbose {
+		return CommandWith(os.Stdout, os.Stderr, name, args...)
+	}
+	return CommandWith(nil, nil, name, args...)
+}
+
+// CommandWith builds a Cmd writing its output to stdout and stderr, discarding it when nil.
+func CommandWith(stdout io.Writer, stderr io.Writer, name string, args ...string) Cmd {
+	return Cmd{Name: name, Args: args, Stdout: stdout, Stderr: stderr}
+}
+
+// String renders the command as a shell-quoted command line.
+func (c Cmd) String() string {
+	parts := []string{quote(c.Name)}
+	for _, arg := range c.Args {
+		parts = append(parts, quote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+func quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if !strings.ContainsAny(s, " \t\n\"'`$\\|&;<>()*?[]{}#~!") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Runner executes external commands on behalf of the internal packages.
+type Runner interface {
+	// Run executes the command, streaming its output to cmd.Stdout/cmd.Stderr.
+	Run(cmd Cmd) error
+	// Output executes the command and returns its standard output.
+	Output(cmd Cmd) ([]byte, error)
+	// WriteFile writes a file consumed by a later command, creating parent directories.
+	WriteFile(path string, data []byte, perm os.FileMode) error
+}
+
+// Exec runs commands on the host with os/exec. When Log is set, the output of
+// every command is recorded in it.
+type Exec struct {
+	Log *Log
+}
+
+// Bytes of output kept to explain a failure
+const outputTail = 16 * 1024
+
+func (e Exec) Run(cmd Cmd) error {
+	stderr := &tailBuffer{max: outputTail}
+	output := &tailBuffer{max: outputTail}
+	log := e.Log.command(cmd)
+
+	c := exec.Command(cmd.Name, cmd.Args...)
+	c.Dir = cmd.Dir
+	c.Env = environ(cmd.Env)
+	c.Stdout = writers(cmd.Stdout, output, log)
+	c.Stderr = writers(cmd.Stderr, stderr, output, log)
+	err := c.Run()
+	log.finish(err)
+
+	// The end of the output is only worth repeating when it was not shown
+	if cmd.Stdout != nil || cmd.Stderr != nil {
+		output = nil
+	}
+	return wrapError(cmd, err, stderr, output, e.Log.Path())
+}
+
+func (e Exec) Output(cmd Cmd) ([]byte, error) {
+	stderr := &tailBuffer{max: outputTail}
+	log := e.Log.command(cmd)
+
+	c := exec.Command(cmd.Name, cmd.Args...)
+	c.Dir = cmd.Dir
+	c.Env = environ(cmd.Env)
+	c.Stderr = writers(cmd.Stderr, stderr, log)
+	output, err := c.Output()
+	log.finish(err)
+
+	return output, wrapError(cmd, err, stderr, nil, e.Log.Path())
+}
+
+// environ returns the environment of a command, nil to inherit the one of the process.
+func environ(env []string) []string {
+	if len(env) == 0 {
+		return nil
+	}
+	return append(os.Environ(), env...)
+}
+
+func (Exec) WriteFile(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, perm)
+}
+
+// DryRun prints the commands and files it is given instead of executing or writing them.
+type DryRun struct {
+	Out io.Writer
+
+	mu sync.Mutex
+}
+
+func (d *DryRun) Run(cmd Cmd) error {
+	_, err := d.Output(cmd)
+	return err
+}
+
+func (d *DryRun) Output(cmd Cmd) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if cmd.Dir != "" {
+		fmt.Fprintf(d.Out, "$ (cd %s && %s)\n", quote(cmd.Dir), cmd)
+	} else {
+		fmt.Fprintf(d.Out, "$ %s\n", cmd)
+	}
+	return nil, nil
+}
+
+// IsDryRun reports whether r prints the commands instead of executing them, in
+// which case their output is always empty.
+func IsDryRun(r Runner) bool {
+	_, ok := r.(*DryRun)
+	return ok
+}
+
+func (d *DryRun) WriteFile(path string, data []byte, perm os.FileMode) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	fmt.Fprintf(d.Out, "# write %s (%s)\n", path, perm)
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		fmt.Fprintf(d.Out, "#   %s\n", line)
+	}
+	return nil
+}
+
+// Recorder is a fake Runner that records every command instead of executing it.
+// Stub, when set, provides the output and error returned for a command.
+type Recorder struct {
+	Stub func(cmd Cmd) ([]byte, error)
+
+	mu    sync.Mutex
+	calls []Cmd
+	files map[string][]byte
+}
+
+func (r *Recorder) Run(cmd Cmd) error {
+	_, err := r.Output(cmd)
+	return err
+}
+
+func (r *Recorder) Output(cmd Cmd) ([]byte, error) {
+	r.mu.Lock()
+	r.calls = append(r.calls, cmd)
+	r.mu.Unlock()
+
+	if r.Stub == nil {
+		return nil, nil
+	}
+	return r.Stub(cmd)
+}
+
+func (r *Recorder) WriteFile(path string, data []byte, perm os.FileMode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.files == nil {
+		r.files = make(map[string][]byte)
+	}
+	r.files[path] = append([]byte(nil), data...)
+	return nil
+}
+
+// File returns the content recorded for path by WriteFile.
+func (r *Recorder) File(path string) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, ok := r.files[path]
+	return data, ok
+}
+
+// Calls returns the commands recorded so far.
+func (r *Recorder) Calls() []Cmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Cmd(nil), r.calls...)
+}
+
+// Lines returns the recorded commands rendered as command lines.
+func (r *Recorder) Lines() []string {
+	var lines []string
+	for _, cmd := range r.Calls() {
+		lines = append(lines, cmd.String())
+	}
+	return lines
+}
+
+// Reply is the output, or error, a Recorder stub returns for a command.
+type Reply struct {
+	Output string
+	Err    error
+}
+
+// StubPrefixes returns a Recorder stub answering every command with the
+// output of the longest key of outputs its command line starts with.
+func StubPrefixes(outputs map[string]string) func(cmd Cmd) ([]byte, error) {
+	replies := make(map[string]Reply, len(outputs))
+	for prefix, output := range outputs {
+		replies[prefix] = Reply{Output: output}
+	}
+	return StubReplies(replies)
+}
+
+// StubReplies returns a Recorder stub answering every command with the reply
+// of the longest key of replies its command line starts with, and nothing
+// when none matches.
+func StubReplies(replies map[string]Reply) func(cmd Cmd) ([]byte, error) {
+	return func(cmd Cmd) ([]byte, error) {
+		line, match := cmd.String(), ""
+		found := false
+		for prefix := range replies {
+			if strings.HasPrefix(line, prefix) && (!found || len(prefix) > len(match)) {
+				match, found = prefix, true
+			}
+		}
+		if !found {
+			return nil, nil
+		}
+		reply := replies[match]
+		if reply.Output == "" {
+			return nil, reply.Err
+		}
+		return []byte(reply.Output), reply.Err
+	}
+}